@@ -1,39 +1,186 @@
 package gap
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // App is the fundamental building block for applications
 type App struct {
-	routes       map[string]route
-	errorHandler func(interface{}, http.ResponseWriter)
-}
-
-type route struct {
-	method   string
-	endpoint endpoint
+	paths          []*routePath
+	middleware     []Middleware
+	chainVersion   int32
+	notFound       handlerCache
+	notAllowed     handlerCache
+	providers      map[reflect.Type]reflect.Value
+	inputBinders   map[string]InputBinder
+	outputWriters  map[string]OutputWriter
+	errorPlanCache sync.Map
+	encoders       []encoder
+	uploadLimits   uploadLimits
+	errorHandler   func(interface{}, http.ResponseWriter)
+	shutdownHooks  []func()
+	apiTitle       string
+	apiVersion     string
+	problemDetails bool
+	checkOrigin    func(*http.Request) bool
+	maxMessageSize int64
+	sockets        openSockets
+	collectTags    bool
+	tagErrors      TagErrors
 }
 
 // New is the proper way to create a new App
 func New() *App {
-	return &App{
-		routes:       map[string]route{},
-		errorHandler: defaultErrorHandler,
+	app := &App{
+		paths:          []*routePath{},
+		providers:      map[reflect.Type]reflect.Value{},
+		inputBinders:   map[string]InputBinder{},
+		outputWriters:  map[string]OutputWriter{},
+		encoders:       defaultEncoders(),
+		maxMessageSize: DefaultMaxMessageSize,
+		apiTitle:       "API",
+		apiVersion:     "1.0.0",
 	}
+	app.errorHandler = app.defaultErrorHandler
+	return app
 }
 
-func defaultErrorHandler(ierr interface{}, response http.ResponseWriter) {
+func (app *App) defaultErrorHandler(ierr interface{}, response http.ResponseWriter) {
 	log.Print("PANIC: ", ierr)
+	if app.problemDetails {
+		writeProblem(response, 500, "internal server error", nil)
+		return
+	}
 	response.Header().Set("Content-Type", "application/json")
 	response.WriteHeader(500)
 	response.Write([]byte(`{"error":"internal server error"}`))
 }
 
-// Route binds request method and path to target endpoint
-func (app *App) Route(method string, path string, fn interface{}) {
-	app.routes[path] = route{method, newEndpoint(fn)}
+// Route binds request method and path to target endpoint.
+// Path segments in braces (e.g. /users/{id}) match any value and can be bound as params.
+// Each path can hold one endpoint per method.
+// Optional middleware wraps only this route, inside the ones added with Use.
+func (app *App) Route(method string, path string, fn interface{}, middleware ...Middleware) *Route {
+	return app.addRoute(method, path, newEndpoint(fn, app), middleware, nil)
+}
+
+// WebSocket routes GET requests on path to a WebSocket endpoint.
+// The endpoint takes a *Conn, along with an optional input struct and provided values, bound before the upgrade.
+// Returning an error closes the connection with it as reason.
+func (app *App) WebSocket(path string, fn interface{}, middleware ...Middleware) *Route {
+	return app.addRoute("GET", path, newSocketEndpoint(fn, app), middleware, nil)
+}
+
+// Group creates a set of routes sharing a path prefix (e.g. /api/v1) and middleware.
+// Groups can be nested.
+func (app *App) Group(prefix string, middleware ...Middleware) *Group {
+	return newGroup(app, nil, prefix, middleware)
+}
+
+func (app *App) addRoute(method string, path string, ep endpoint, middleware []Middleware, group *Group) *Route {
+	rt := &Route{method: method, endpoint: ep, middleware: middleware, group: group, hidden: ep.socket}
+	rp := app.routePath(path)
+	if errs := ep.checkParams(rp.segments); len(errs) > 0 {
+		app.reportTagErrors(errs)
+	}
+	rp.add(rt)
+	return rt
+}
+
+// Validate type-checks the tags of error structs declared with Route.Errors, which are otherwise only checked once returned.
+// Endpoint input and output tags are checked by Route itself, which panics listing every problem of the endpoint,
+// unless they are collected (see CollectTagErrors).
+// Validate returns TagErrors with all problems found on every route, or nil.
+func (app *App) Validate() error {
+	errs := append(TagErrors{}, app.tagErrors...)
+	for _, rp := range app.paths {
+		for _, method := range rp.methods() {
+			rt := rp.routes[method]
+			for _, err := range rt.errors {
+				if rvErr := errorStruct(reflect.ValueOf(err)); isOutputStruct(rvErr) {
+					_, structErrs := newOutputPlans(rt.endpoint.name, rvErr.Type(), app.outputWriters)
+					errs = append(errs, structErrs...)
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Use adds middleware that wraps every request handled by the app, including not found ones.
+// Middleware runs in the order it was added, after the route is matched.
+func (app *App) Use(middleware ...Middleware) {
+	app.middleware = append(app.middleware, middleware...)
+	atomic.AddInt32(&app.chainVersion, 1)
+}
+
+func (app *App) routePath(path string) *routePath {
+	for _, rp := range app.paths {
+		if rp.path == path {
+			return rp
+		}
+	}
+	rp := newRoutePath(path)
+	app.paths = append(app.paths, rp)
+	return rp
+}
+
+// Provide registers a function that resolves a value for each request, e.g. a DB handle or the authenticated user.
+// It must implement func(*http.Request) (T, error). Endpoints routed after this can take extra parameters of type T.
+func (app *App) Provide(fn interface{}) {
+	rtype, provider := newProvider(fn)
+	if _, found := app.providers[rtype]; found {
+		panic(errors.New("duplicate provider"))
+	}
+	app.providers[rtype] = provider
+}
+
+// RegisterInput adds a custom input source, bound by binder (e.g. request:"jwtclaim,sub" for kind jwtclaim).
+// Endpoints routed after this can tag input fields with it. Built-in kinds can't be replaced.
+func (app *App) RegisterInput(kind string, binder InputBinder) {
+	if builtinInputs[kind] {
+		panic(errors.New("reserved input kind"))
+	}
+	if _, found := app.inputBinders[kind]; found {
+		panic(errors.New("duplicate input binder"))
+	}
+	app.inputBinders[kind] = binder
+}
+
+// RegisterOutput adds a custom output kind, written by writer (e.g. response:"link,next" for kind link).
+// Endpoints routed after this can tag output and error fields with it. Built-in kinds can't be replaced.
+func (app *App) RegisterOutput(kind string, writer OutputWriter) {
+	if builtinOutputs[kind] {
+		panic(errors.New("reserved output kind"))
+	}
+	if _, found := app.outputWriters[kind]; found {
+		panic(errors.New("duplicate output writer"))
+	}
+	app.outputWriters[kind] = writer
+}
+
+// Encoder registers a codec for responses of the given media type, replacing any previous one.
+// Response fields are encoded with the codec best matching the request Accept header.
+// JSON, XML, MessagePack and CBOR are available by default, with JSON used when there's no preference.
+func (app *App) Encoder(mime string, codec Codec) {
+	for i, enc := range app.encoders {
+		if enc.mime == mime {
+			app.encoders[i].codec = codec
+			return
+		}
+	}
+	app.encoders = append(app.encoders, encoder{mime, codec})
 }
 
 // ErrorHandler allows replacing of the default error handler
@@ -41,36 +188,133 @@ func (app *App) ErrorHandler(handler func(interface{}, http.ResponseWriter)) {
 	app.errorHandler = handler
 }
 
+// ProblemDetails toggles answering request and endpoint errors as RFC 7807 problem documents (application/problem+json).
+// Not found, method not allowed, not acceptable and (with the default error handler) internal errors are answered the same way.
+// Output struct errors are still written by their tags.
+func (app *App) ProblemDetails(enabled bool) {
+	app.problemDetails = enabled
+}
+
+// CollectTagErrors toggles collecting the tag problems of endpoints for Validate, instead of panicking on the first bad route.
+// Apps with collected problems answer every request as an internal error, through the error handler.
+func (app *App) CollectTagErrors(enabled bool) {
+	app.collectTags = enabled
+}
+
+// reportTagErrors panics with the tag problems of an endpoint, unless the app collects them
+func (app *App) reportTagErrors(errs TagErrors) {
+	if !app.collectTags {
+		panic(errs)
+	}
+	app.tagErrors = append(app.tagErrors, errs...)
+}
+
 // ServeHTTP fullfills the http.Handler interface implementation
 func (app *App) ServeHTTP(response http.ResponseWriter, request *http.Request) {
 	defer writeErrorOnPanic(response, app.errorHandler)
-	route, found := app.routes[request.URL.Path]
-	if !found {
-		writeNotFound(response)
-		return
+	if len(app.tagErrors) > 0 {
+		panic(app.tagErrors)
 	}
-	if route.method != request.Method {
-		writeMethodNotAllowed(response)
-		return
+	route, match, allowed := app.findRoute(request)
+	var handler http.Handler
+	version := atomic.LoadInt32(&app.chainVersion)
+	if allowed == nil {
+		handler = app.notFound.get(version, func() http.Handler { return chain(app.middleware, app.notFoundHandler()) })
+	} else if route == nil {
+		request = request.WithContext(context.WithValue(request.Context(), allowedKey{}, allowed))
+		handler = app.notAllowed.get(version, func() http.Handler { return chain(app.middleware, app.methodNotAllowedHandler()) })
+	} else {
+		request = withRoute(request, match.path, match.params)
+		handler = route.chain.get(version, route.handler)
+	}
+	handler.ServeHTTP(response, request)
+}
+
+// findRoute returns the most specific route matching both path and method.
+// If no route matches the method, the methods allowed on the path are returned instead.
+func (app *App) findRoute(request *http.Request) (*Route, routeMatch, []string) {
+	parts := splitPath(request)
+	var best *routePath
+	var bestParams map[string]string
+	var matched []*routePath
+	for _, rp := range app.paths {
+		params, ok := rp.match(parts)
+		if !ok {
+			continue
+		}
+		matched = append(matched, rp)
+		if _, found := rp.routes[request.Method]; found && (best == nil || rp.moreSpecific(best)) {
+			best, bestParams = rp, params
+		}
+	}
+	if best != nil {
+		return best.routes[request.Method], routeMatch{best.path, bestParams}, []string{}
 	}
-	route.endpoint.handle(request, response)
+	var allowed []string
+	for _, rp := range matched {
+		allowed = append(allowed, rp.methods()...)
+	}
+	return nil, routeMatch{}, allowed
 }
 
-// Run is a shortcut for starting a web server for your app
+// Run is a shortcut for starting a web server for your app on port 8000.
+// See RunWithOptions for more control over the server.
 func (app *App) Run() {
-	log.Fatal(http.ListenAndServe(":8000", app))
+	if err := app.RunWithOptions(ServerOptions{Addr: ":8000"}); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func writeNotFound(response http.ResponseWriter) {
-	response.WriteHeader(404)
-	response.Write([]byte(`{"error":"not found"}`))
+func (app *App) notFoundHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if app.problemDetails {
+			writeProblem(response, 404, "not found", nil)
+			return
+		}
+		response.WriteHeader(404)
+		response.Write([]byte(`{"error":"not found"}`))
+	})
 }
 
-func writeMethodNotAllowed(response http.ResponseWriter) {
+// allowedKey holds the methods allowed on the path of a request no route matched the method of
+type allowedKey struct{}
+
+func (app *App) methodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		allowed, _ := request.Context().Value(allowedKey{}).([]string)
+		app.writeMethodNotAllowed(response, allowed)
+	})
+}
+
+func (app *App) writeMethodNotAllowed(response http.ResponseWriter, allowed []string) {
+	unique := map[string]bool{}
+	methods := []string{}
+	for _, method := range allowed {
+		if !unique[method] {
+			unique[method] = true
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	response.Header().Set("Allow", strings.Join(methods, ", "))
+	if app.problemDetails {
+		writeProblem(response, 405, "method not allowed", nil)
+		return
+	}
 	response.WriteHeader(405)
 	response.Write([]byte(`{"error":"method not allowed"}`))
 }
 
+func (app *App) writeNotAcceptable(response http.ResponseWriter) {
+	if app.problemDetails {
+		writeProblem(response, 406, "not acceptable", nil)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(406)
+	response.Write([]byte(`{"error":"not acceptable"}`))
+}
+
 func writeErrorOnPanic(httpResponse http.ResponseWriter, errorHandler func(interface{}, http.ResponseWriter)) {
 	ierr := recover()
 	if ierr != nil {
@@ -51,6 +51,15 @@ func TestApp(t *testing.T) {
 		}
 	})
 
+	t.Run("method not allowed lists allowed methods", func(t *testing.T) {
+		request := httptest.NewRequest("POST", "/profiles/read", nil)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Header().Get("Allow") != "GET" {
+			t.Errorf("unexpected allow header: %s", response.Header().Get("Allow"))
+		}
+	})
+
 	t.Run("invalid json is answered with bad request", func(t *testing.T) {
 		request := httptest.NewRequest("GET", "/profiles/read", nil)
 		response := httptest.NewRecorder()
@@ -83,6 +92,85 @@ func TestApp(t *testing.T) {
 		}
 	})
 
+	t.Run("routes with params bind path segments", func(t *testing.T) {
+		type tIn struct {
+			UserID string `request:"param,id"`
+			PostID string `request:"param,postID"`
+		}
+		type tOut struct {
+			UserID string `response:"json,user_id"`
+			PostID string `response:"json,post_id"`
+		}
+		app := New()
+		app.Route("GET", "/users/{id}/posts/{postID}", func(input tIn) tOut { return tOut{input.UserID, input.PostID} })
+		request := httptest.NewRequest("GET", "/users/42/posts/7", nil)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Body.String() != `{"post_id":"7","user_id":"42"}` {
+			t.Errorf("failed to bind path params: %s", response.Body.String())
+		}
+	})
+
+	t.Run("static routes take precedence over params regardless of order", func(t *testing.T) {
+		type tOut struct {
+			Name string `response:"json,name"`
+		}
+		app := New()
+		app.Route("GET", "/users/{id}", func() tOut { return tOut{"param"} })
+		app.Route("GET", "/users/me", func() tOut { return tOut{"static"} })
+		request := httptest.NewRequest("GET", "/users/me", nil)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Body.String() != `{"name":"static"}` {
+			t.Errorf("failed to prefer static route: %s", response.Body.String())
+		}
+	})
+
+	t.Run("same path can route different methods", func(t *testing.T) {
+		type tOut struct {
+			Method string `response:"json,method"`
+		}
+		app := New()
+		app.Route("GET", "/items", func() tOut { return tOut{"get"} })
+		app.Route("POST", "/items", func() tOut { return tOut{"post"} })
+		app.Route("DELETE", "/items/{id}", func() tOut { return tOut{"delete"} })
+		for _, method := range []string{"GET", "POST"} {
+			request := httptest.NewRequest(method, "/items", nil)
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, request)
+			if response.Body.String() != `{"method":"`+strings.ToLower(method)+`"}` {
+				t.Errorf("failed to route %s: %s", method, response.Body.String())
+			}
+		}
+		request := httptest.NewRequest("PUT", "/items", nil)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != 405 || response.Header().Get("Allow") != "GET, POST" {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Header().Get("Allow"))
+		}
+	})
+
+	t.Run("falls back to less specific path matching the method", func(t *testing.T) {
+		type tOut struct {
+			Name string `response:"json,name"`
+		}
+		app := New()
+		app.Route("GET", "/users/me", func() tOut { return tOut{"static"} })
+		app.Route("POST", "/users/{id}", func() tOut { return tOut{"param"} })
+		request := httptest.NewRequest("POST", "/users/me", nil)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Body.String() != `{"name":"param"}` {
+			t.Errorf("failed to fall back to param route: %s", response.Body.String())
+		}
+		request = httptest.NewRequest("PUT", "/users/me", nil)
+		response = httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Header().Get("Allow") != "GET, POST" {
+			t.Errorf("unexpected allow header: %s", response.Header().Get("Allow"))
+		}
+	})
+
 	t.Run("error handler", func(t *testing.T) {
 
 		t.Run("default error handler logs panic message", func(t *testing.T) {
@@ -128,6 +216,25 @@ func TestApp(t *testing.T) {
 			}
 		})
 
+		t.Run("default error handler writes problem details on problem details mode", func(t *testing.T) {
+			defer func() {
+				log.SetOutput(os.Stderr)
+			}()
+			log.SetOutput(ioutil.Discard)
+			app := New()
+			app.ProblemDetails(true)
+			app.Route("GET", "/panic", func() { panic("something went wrong") })
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, httptest.NewRequest("GET", "/panic", nil))
+			expected := `{"detail":"internal server error","status":500,"title":"Internal Server Error","type":"about:blank"}`
+			if response.Code != 500 || response.Body.String() != expected {
+				t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+			}
+			if response.Header().Get("Content-Type") != "application/problem+json" {
+				t.Error("failed to set content-type header")
+			}
+		})
+
 		t.Run("app can configure a different error handler", func(t *testing.T) {
 			msg := ""
 			type tIn struct{}
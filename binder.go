@@ -0,0 +1,61 @@
+package gap
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// InputBinder resolves input fields tagged with a custom source, registered with App.RegisterInput.
+// Bind gets the whole request, the key given on the tag (e.g. sub for request:"jwtclaim,sub") and the field type.
+// It returns a value of the field type, or a string parsed like query values. Nil leaves the field empty.
+// Returned errors are answered like the ones returned by endpoints.
+type InputBinder interface {
+	Bind(request *http.Request, key string, rtype reflect.Type) (interface{}, error)
+}
+
+// InputBinderFunc adapts a function to the InputBinder interface
+type InputBinderFunc func(request *http.Request, key string, rtype reflect.Type) (interface{}, error)
+
+// Bind calls fn(request, key, rtype)
+func (fn InputBinderFunc) Bind(request *http.Request, key string, rtype reflect.Type) (interface{}, error) {
+	return fn(request, key, rtype)
+}
+
+var builtinInputs = map[string]bool{
+	"header": true, "path": true, "param": true, "query": true, "cookie": true,
+	"json": true, "form": true, "file": true, "body": true,
+}
+
+// bindError carries an error returned by a binder up to the endpoint, to be answered as such
+type bindError struct {
+	err error
+}
+
+type customInput struct {
+	kind   string
+	key    string
+	rtype  reflect.Type
+	binder InputBinder
+}
+
+func (input customInput) read(request *lazyRequest) reflect.Value {
+	value, err := input.binder.Bind(request.httpRequest, input.key, input.rtype)
+	if err != nil {
+		panic(bindError{err})
+	}
+	if value == nil {
+		return reflect.Zero(input.rtype)
+	}
+	rvalue := reflect.ValueOf(value)
+	if rvalue.Type().AssignableTo(input.rtype) {
+		return rvalue
+	}
+	if raw, ok := value.(string); ok && canParseString(input.rtype) {
+		return parseInput(raw, true, input.rtype, input.kind, input.key)
+	}
+	if rvalue.Type().ConvertibleTo(input.rtype) {
+		return rvalue.Convert(input.rtype)
+	}
+	panic(fmt.Errorf("input binder %s returned %s for field of type %s", input.kind, rvalue.Type(), input.rtype))
+}
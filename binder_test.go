@@ -0,0 +1,125 @@
+package gap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestInputBinder(t *testing.T) {
+
+	type tUser struct {
+		Name string
+	}
+	type tUserKey struct{}
+	app := New()
+	app.RegisterInput("claim", InputBinderFunc(func(request *http.Request, key string, rtype reflect.Type) (interface{}, error) {
+		token := request.Header.Get("Authorization")
+		if token == "" {
+			return nil, nil
+		}
+		if token != "valid" {
+			return nil, RequestError{Status: 401, Message: "invalid token"}
+		}
+		return map[string]string{"sub": "42", "role": "admin"}[key], nil
+	}))
+	app.RegisterInput("ctx", InputBinderFunc(func(request *http.Request, key string, rtype reflect.Type) (interface{}, error) {
+		if key == "fail" {
+			return nil, errors.New("failed to bind")
+		}
+		return request.Context().Value(tUserKey{}), nil
+	}))
+	type tIn struct {
+		Sub  int     `request:"claim,sub"`
+		Role string  `request:"claim,role"`
+		User *tUser  `request:"ctx,user"`
+		Page float64 `request:"query,page"`
+	}
+	type tOut struct {
+		Sub  int    `response:"field,sub"`
+		Role string `response:"field,role"`
+		User string `response:"field,user"`
+	}
+	app.Route("GET", "/", func(input tIn) tOut {
+		out := tOut{Sub: input.Sub, Role: input.Role}
+		if input.User != nil {
+			out.User = input.User.Name
+		}
+		return out
+	})
+	app.Route("GET", "/fail", func(input struct {
+		User *tUser `request:"ctx,fail"`
+	}) {
+	})
+
+	t.Run("binds custom sources with access to the request", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", "valid")
+		request = request.WithContext(context.WithValue(request.Context(), tUserKey{}, &tUser{"ana"}))
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != 200 || response.Body.String() != `{"role":"admin","sub":42,"user":"ana"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("nil values leave fields empty", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		if response.Code != 200 || response.Body.String() != `{"role":"","sub":0,"user":""}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("binder errors are answered", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", "invalid")
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != 401 || response.Body.String() != `{"error":"invalid token"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+		response = httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/fail", nil))
+		if response.Code != 400 || response.Body.String() != `{"error":"failed to bind"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("strings are parsed into the field type", func(t *testing.T) {
+		app := New()
+		app.RegisterInput("env", InputBinderFunc(func(request *http.Request, key string, rtype reflect.Type) (interface{}, error) {
+			return "abc", nil
+		}))
+		app.Route("GET", "/", func(input struct {
+			Port int `request:"env,PORT"`
+		}) {
+		})
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		if response.Code != 400 || response.Body.String() != `{"error":"invalid value for env \"PORT\": expected integer","problems":[{"source":"env","key":"PORT","reason":"expected integer"}]}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("built-in kinds can't be replaced", func(t *testing.T) {
+		defer assertPanics(t, "reserved input kind")
+		New().RegisterInput("query", InputBinderFunc(nil))
+	})
+
+	t.Run("kinds can't be registered twice", func(t *testing.T) {
+		defer assertPanics(t, "duplicate input binder")
+		app.RegisterInput("claim", InputBinderFunc(nil))
+	})
+
+	t.Run("unregistered kinds are invalid", func(t *testing.T) {
+		defer assertTagPanics(t, "missing or invalid request tag on input field")
+		New().Route("GET", "/", func(input struct {
+			Sub string `request:"claim,sub"`
+		}) {
+		})
+	})
+}
@@ -0,0 +1,377 @@
+package gap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes response fields for a media type.
+// The value is the map of response fields, keyed by the names given on the tags.
+type Codec interface {
+	Encode(writer io.Writer, value interface{}) error
+}
+
+// CodecFunc adapts a function to the Codec interface
+type CodecFunc func(writer io.Writer, value interface{}) error
+
+// Encode calls fn(writer, value)
+func (fn CodecFunc) Encode(writer io.Writer, value interface{}) error {
+	return fn(writer, value)
+}
+
+type encoder struct {
+	mime  string
+	codec Codec
+}
+
+func defaultEncoders() []encoder {
+	return []encoder{
+		{"application/json", CodecFunc(encodeJSON)},
+		{"application/xml", CodecFunc(encodeXML)},
+		{"application/msgpack", CodecFunc(encodeMsgPack)},
+		{"application/x-msgpack", CodecFunc(encodeMsgPack)},
+		{"application/cbor", CodecFunc(encodeCBOR)},
+	}
+}
+
+// negotiate picks the encoder best matching the Accept header, telling if it's acceptable at all.
+// The first encoder is used when there's no Accept header or nothing matches.
+func negotiate(encoders []encoder, accept string) (encoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return encoders[0], true
+	}
+	ranges := parseAccept(accept)
+	best, bestQ, bestPos := -1, 0.0, 0
+	for i, enc := range encoders {
+		q, pos := acceptQuality(ranges, enc.mime)
+		if q > bestQ || (q == bestQ && q > 0 && pos < bestPos) {
+			best, bestQ, bestPos = i, q, pos
+		}
+	}
+	if best < 0 {
+		return encoders[0], false
+	}
+	return encoders[best], true
+}
+
+type mediaRange struct {
+	mime string
+	q    float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mr := mediaRange{strings.ToLower(strings.TrimSpace(params[0])), 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		if mr.mime != "" {
+			ranges = append(ranges, mr)
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of the most specific range matching mime, along with its position
+func acceptQuality(ranges []mediaRange, mime string) (float64, int) {
+	q, pos, specificity := 0.0, len(ranges), -1
+	for i, mr := range ranges {
+		s := -1
+		if mr.mime == mime {
+			s = 2
+		} else if strings.HasSuffix(mr.mime, "/*") && strings.HasPrefix(mime, strings.TrimSuffix(mr.mime, "*")) {
+			s = 1
+		} else if mr.mime == "*/*" || mr.mime == "*" {
+			s = 0
+		}
+		if s > specificity {
+			q, pos, specificity = mr.q, i, s
+		}
+	}
+	return q, pos
+}
+
+func encodeJSON(writer io.Writer, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(body)
+	return err
+}
+
+// normalize reduces value to the types produced by decoding JSON, so it's simple to encode to other formats.
+// This way json tags are respected, whatever the format.
+func normalize(value interface{}) (interface{}, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var normalized interface{}
+	err = decoder.Decode(&normalized)
+	return normalized, err
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeXML(writer io.Writer, value interface{}) error {
+	normalized, err := normalize(value)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	writeXMLElement(buf, "response", normalized)
+	_, err = writer.Write(buf.Bytes())
+	return err
+}
+
+func writeXMLElement(buf *bytes.Buffer, name string, value interface{}) {
+	name = xmlName(name)
+	buf.WriteString("<" + name + ">")
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			writeXMLElement(buf, key, v[key])
+		}
+	case []interface{}:
+		for _, item := range v {
+			writeXMLElement(buf, "item", item)
+		}
+	case nil:
+	default:
+		xml.EscapeText(buf, []byte(toString(v)))
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+// xmlName replaces characters that are not allowed on XML element names
+func xmlName(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		valid := r == '_' || r == '-' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r > 127
+		if !valid || (i == 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9'))) {
+			runes[i] = '_'
+		}
+	}
+	if len(runes) == 0 {
+		return "_"
+	}
+	return string(runes)
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func encodeMsgPack(writer io.Writer, value interface{}) error {
+	normalized, err := normalize(value)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	writeMsgPack(buf, normalized)
+	_, err = writer.Write(buf.Bytes())
+	return err
+}
+
+func writeMsgPack(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeMsgPackInt(buf, i)
+		} else if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, u)
+		} else {
+			f, _ := v.Float64()
+			buf.WriteByte(0xcb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		writeMsgPackHeader(buf, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+	case []interface{}:
+		writeMsgPackHeader(buf, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			writeMsgPack(buf, item)
+		}
+	case map[string]interface{}:
+		writeMsgPackHeader(buf, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, key := range sortedKeys(v) {
+			writeMsgPack(buf, key)
+			writeMsgPack(buf, v[key])
+		}
+	}
+}
+
+// writeMsgPackHeader writes the smallest header for a length, using fixed formats below fixLimit.
+// A zero code8 means there's no 8 bit length format for the type.
+func writeMsgPackHeader(buf *bytes.Buffer, length int, fixCode byte, fixLimit int, code8 byte, code16 byte, code32 byte) {
+	switch {
+	case length < fixLimit:
+		buf.WriteByte(fixCode | byte(length))
+	case code8 != 0 && length <= math.MaxUint8:
+		buf.WriteByte(code8)
+		buf.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	}
+}
+
+func writeMsgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= 0 && i <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(i))
+	case i >= 0:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, uint64(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func encodeCBOR(writer io.Writer, value interface{}) error {
+	normalized, err := normalize(value)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := writeCBOR(buf, normalized); err != nil {
+		return err
+	}
+	_, err = writer.Write(buf.Bytes())
+	return err
+}
+
+func writeCBOR(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil && i >= 0 {
+			writeCBORHeader(buf, 0, uint64(i))
+		} else if err == nil {
+			writeCBORHeader(buf, 1, uint64(-1-i))
+		} else if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			writeCBORHeader(buf, 0, u)
+		} else {
+			f, err := v.Float64()
+			if err != nil {
+				return errors.New("invalid number")
+			}
+			buf.WriteByte(0xfb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		writeCBORHeader(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeCBORHeader(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		writeCBORHeader(buf, 5, uint64(len(v)))
+		for _, key := range sortedKeys(v) {
+			writeCBOR(buf, key)
+			if err := writeCBOR(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeCBORHeader(buf *bytes.Buffer, major byte, length uint64) {
+	major <<= 5
+	switch {
+	case length < 24:
+		buf.WriteByte(major | byte(length))
+	case length <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(length))
+	case length <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(length))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, length)
+	}
+}
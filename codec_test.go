@@ -0,0 +1,124 @@
+package gap
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+
+	t.Run("negotiates encoder from accept header", func(t *testing.T) {
+		type testCase struct {
+			accept     string
+			mime       string
+			acceptable bool
+		}
+		cases := []testCase{
+			testCase{"", "application/json", true},
+			testCase{"*/*", "application/json", true},
+			testCase{"application/*", "application/json", true},
+			testCase{"application/xml", "application/xml", true},
+			testCase{"application/xml, application/json", "application/xml", true},
+			testCase{"application/xml;q=0.5, application/json", "application/json", true},
+			testCase{"application/cbor;q=0.9, */*;q=0.1", "application/cbor", true},
+			testCase{"application/json;q=0, */*", "application/xml", true},
+			testCase{"application/msgpack", "application/msgpack", true},
+			testCase{"text/html", "application/json", false},
+			testCase{"application/json;q=0", "application/json", false},
+		}
+		for _, tcase := range cases {
+			t.Run(tcase.accept, func(t *testing.T) {
+				enc, acceptable := negotiate(defaultEncoders(), tcase.accept)
+				if enc.mime != tcase.mime || acceptable != tcase.acceptable {
+					t.Errorf("unexpected negotiation: %s %v", enc.mime, acceptable)
+				}
+			})
+		}
+	})
+
+	t.Run("encodes values to each format", func(t *testing.T) {
+		type item struct {
+			Name string `json:"name"`
+		}
+		value := map[string]interface{}{"a": 1, "b": []interface{}{true, nil}, "c": item{"x"}}
+		type testCase struct {
+			codec    CodecFunc
+			expected []byte
+		}
+		cases := map[string]testCase{
+			"json": testCase{encodeJSON, []byte(`{"a":1,"b":[true,null],"c":{"name":"x"}}`)},
+			"xml": testCase{encodeXML, []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<response><a>1</a><b><item>true</item><item></item></b><c><name>x</name></c></response>`)},
+			"msgpack": testCase{encodeMsgPack, []byte{0x83,
+				0xa1, 'a', 0x01,
+				0xa1, 'b', 0x92, 0xc3, 0xc0,
+				0xa1, 'c', 0x81, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'x'}},
+			"cbor": testCase{encodeCBOR, []byte{0xa3,
+				0x61, 'a', 0x01,
+				0x61, 'b', 0x82, 0xf5, 0xf6,
+				0x61, 'c', 0xa1, 0x64, 'n', 'a', 'm', 'e', 0x61, 'x'}},
+		}
+		for name, tcase := range cases {
+			t.Run(name, func(t *testing.T) {
+				buf := &bytes.Buffer{}
+				if err := tcase.codec(buf, value); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !bytes.Equal(buf.Bytes(), tcase.expected) {
+					t.Errorf("unexpected encoding: %q", buf.Bytes())
+				}
+			})
+		}
+	})
+
+	t.Run("encodes numbers to binary formats", func(t *testing.T) {
+		type testCase struct {
+			value   interface{}
+			msgpack []byte
+			cbor    []byte
+		}
+		cases := []testCase{
+			testCase{-1, []byte{0xff}, []byte{0x20}},
+			testCase{-100, []byte{0xd0, 0x9c}, []byte{0x38, 0x63}},
+			testCase{200, []byte{0xcc, 0xc8}, []byte{0x18, 0xc8}},
+			testCase{300, []byte{0xcd, 0x01, 0x2c}, []byte{0x19, 0x01, 0x2c}},
+			testCase{70000, []byte{0xce, 0x00, 0x01, 0x11, 0x70}, []byte{0x1a, 0x00, 0x01, 0x11, 0x70}},
+			testCase{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, []byte{0xfb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		}
+		for _, tcase := range cases {
+			t.Run(fmt.Sprint(tcase.value), func(t *testing.T) {
+				buf := &bytes.Buffer{}
+				encodeMsgPack(buf, tcase.value)
+				if !bytes.Equal(buf.Bytes(), tcase.msgpack) {
+					t.Errorf("unexpected msgpack: % x", buf.Bytes())
+				}
+				buf.Reset()
+				encodeCBOR(buf, tcase.value)
+				if !bytes.Equal(buf.Bytes(), tcase.cbor) {
+					t.Errorf("unexpected cbor: % x", buf.Bytes())
+				}
+			})
+		}
+	})
+
+	t.Run("uses larger headers for longer strings", func(t *testing.T) {
+		str := string(bytes.Repeat([]byte("x"), 40))
+		buf := &bytes.Buffer{}
+		encodeMsgPack(buf, str)
+		if !bytes.Equal(buf.Bytes()[:2], []byte{0xd9, 40}) {
+			t.Errorf("unexpected msgpack header: % x", buf.Bytes()[:2])
+		}
+		buf.Reset()
+		encodeCBOR(buf, str)
+		if !bytes.Equal(buf.Bytes()[:2], []byte{0x78, 40}) {
+			t.Errorf("unexpected cbor header: % x", buf.Bytes()[:2])
+		}
+	})
+
+	t.Run("replaces invalid characters on xml names", func(t *testing.T) {
+		if xmlName("user id") != "user_id" || xmlName("1st") != "_st" || xmlName("") != "_" {
+			t.Error("failed to sanitize xml names")
+		}
+	})
+}
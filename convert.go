@@ -0,0 +1,116 @@
+package gap
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// canParseString tells if request strings can be parsed into values of rtype
+func canParseString(rtype reflect.Type) bool {
+	if rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+	if reflect.PtrTo(rtype).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch rtype.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// parseInput converts an optional request string to rtype.
+// Absent values, as well as empty ones on non-string types, yield the zero value.
+func parseInput(raw string, found bool, rtype reflect.Type, source string, key string) reflect.Value {
+	if !found || (raw == "" && baseKind(rtype) != reflect.String) {
+		return reflect.Zero(rtype)
+	}
+	value, err := parseString(raw, rtype)
+	if err != nil {
+		panic(newBadRequest(fmt.Sprintf(`invalid value for %s "%s": %s`, source, key, err), source, key, err.Error()))
+	}
+	return value
+}
+
+func baseKind(rtype reflect.Type) reflect.Kind {
+	if rtype.Kind() == reflect.Ptr {
+		return rtype.Elem().Kind()
+	}
+	return rtype.Kind()
+}
+
+func parseString(raw string, rtype reflect.Type) (reflect.Value, error) {
+	if rtype.Kind() == reflect.Ptr {
+		value, err := parseString(raw, rtype.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(rtype.Elem())
+		ptr.Elem().Set(value)
+		return ptr, nil
+	}
+	value := reflect.New(rtype).Elem()
+	if reflect.PtrTo(rtype).Implements(textUnmarshalerType) {
+		unmarshaler := value.Addr().Interface().(encoding.TextUnmarshaler)
+		if err := unmarshaler.UnmarshalText([]byte(raw)); err != nil {
+			if rtype == timeType {
+				return value, errors.New("expected RFC 3339 time")
+			}
+			return value, err
+		}
+		return value, nil
+	}
+	if rtype == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return value, errors.New("expected duration")
+		}
+		value.SetInt(int64(duration))
+		return value, nil
+	}
+	switch rtype.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return value, errors.New("expected boolean")
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, rtype.Bits())
+		if err != nil {
+			return value, errors.New("expected integer")
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, rtype.Bits())
+		if err != nil {
+			return value, errors.New("expected unsigned integer")
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, rtype.Bits())
+		if err != nil {
+			return value, errors.New("expected number")
+		}
+		value.SetFloat(f)
+	default:
+		return value, errors.New("unsupported type")
+	}
+	return value, nil
+}
@@ -0,0 +1,99 @@
+package gap
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvert(t *testing.T) {
+
+	t.Run("parses strings into supported types", func(t *testing.T) {
+		type status string
+		page := 2
+		cases := []interface{}{
+			"hello",
+			status("active"),
+			int(-1), int8(2), int16(3), int32(4), int64(5),
+			uint(1), uint8(2), uint16(3), uint32(4), uint64(5),
+			float32(1.5), float64(2.5),
+			true,
+			90 * time.Second,
+			time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC),
+			&page,
+		}
+		raws := []string{
+			"hello", "active",
+			"-1", "2", "3", "4", "5",
+			"1", "2", "3", "4", "5",
+			"1.5", "2.5",
+			"true",
+			"1m30s",
+			"2021-05-01T12:30:00Z",
+			"2",
+		}
+		for i, expected := range cases {
+			t.Run(fmt.Sprintf("%T", expected), func(t *testing.T) {
+				rtype := reflect.TypeOf(expected)
+				value, err := parseString(raws[i], rtype)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !reflect.DeepEqual(value.Interface(), expected) {
+					t.Errorf("unexpected value: %v", value.Interface())
+				}
+			})
+		}
+	})
+
+	t.Run("reports invalid values", func(t *testing.T) {
+		type testCase struct {
+			raw   string
+			value interface{}
+			err   string
+		}
+		cases := []testCase{
+			testCase{"abc", 0, "expected integer"},
+			testCase{"300", int8(0), "expected integer"},
+			testCase{"-1", uint(0), "expected unsigned integer"},
+			testCase{"abc", 0.0, "expected number"},
+			testCase{"yes", false, "expected boolean"},
+			testCase{"10", time.Duration(0), "expected duration"},
+			testCase{"yesterday", time.Time{}, "expected RFC 3339 time"},
+		}
+		for _, tcase := range cases {
+			t.Run(fmt.Sprintf("%T", tcase.value), func(t *testing.T) {
+				_, err := parseString(tcase.raw, reflect.TypeOf(tcase.value))
+				if err == nil || err.Error() != tcase.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("absent and empty values yield zero values", func(t *testing.T) {
+		if parseInput("", false, reflect.TypeOf(0), "query", "page").Interface() != 0 {
+			t.Error("absent int should be zero")
+		}
+		if parseInput("", true, reflect.TypeOf(0), "query", "page").Interface() != 0 {
+			t.Error("empty int should be zero")
+		}
+		if !parseInput("", false, reflect.TypeOf((*int)(nil)), "query", "page").IsNil() {
+			t.Error("absent pointer should be nil")
+		}
+		value := parseInput("", true, reflect.TypeOf((*string)(nil)), "query", "q")
+		if value.IsNil() || value.Elem().Interface() != "" {
+			t.Error("empty string pointer should point to empty string")
+		}
+	})
+
+	t.Run("tells which types can be parsed", func(t *testing.T) {
+		if !canParseString(reflect.TypeOf(0)) || !canParseString(reflect.TypeOf(time.Time{})) || !canParseString(reflect.TypeOf((*bool)(nil))) {
+			t.Error("failed to accept supported types")
+		}
+		if canParseString(reflect.TypeOf(struct{}{})) || canParseString(reflect.TypeOf([]int{})) {
+			t.Error("failed to reject unsupported types")
+		}
+	})
+}
@@ -1,34 +1,54 @@
 package gap
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"reflect"
+	"runtime"
+	"strings"
+	"time"
 )
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 type endpoint struct {
-	rval      reflect.Value
-	rtype     reflect.Type
-	inFields  map[string]inputField
-	outFields map[string]outputField
+	app         *App
+	name        string
+	rval        reflect.Value
+	rtype       reflect.Type
+	inType      reflect.Type
+	inIndex     int
+	inPtr       bool
+	providers   []reflect.Value
+	inPlans     []inputPlan
+	outPlans    []outputPlan
+	encodes     bool
+	validations []fieldValidation
+	socket      bool
+	connIndex   int
+	context     bool
+	timeout     time.Duration
 }
 
-func newEndpoint(function interface{}) endpoint {
-	ep := endpoint{}
+func newEndpoint(function interface{}, app *App) endpoint {
+	ep := endpoint{app: app}
 	ep.rval = reflect.ValueOf(function)
 	ep.rtype = reflect.TypeOf(function)
 	validateEndpointInterface(ep.rtype)
-	ep.setupInputFields()
-	ep.setupOutputFields()
+	ep.name = runtime.FuncForPC(ep.rval.Pointer()).Name()
+	ep.setupParams(app.providers)
+	if errs := append(ep.setupInputFields(), ep.setupOutputFields()...); len(errs) > 0 {
+		app.reportTagErrors(errs)
+	}
 	return ep
 }
 
 func validateEndpointInterface(rtype reflect.Type) {
-	if rtype.NumIn() > 1 ||
+	if rtype.Kind() != reflect.Func ||
 		rtype.NumOut() > 2 ||
-		(rtype.NumIn() == 1 && !typeIsStruct(rtype.In(0))) ||
-		(rtype.NumOut() == 1 && (!typeIsStruct(rtype.Out(0)) && !typeIsError(rtype.Out(0)))) ||
-		(rtype.NumOut() == 2 && (!typeIsStruct(rtype.Out(0)) || !typeIsError(rtype.Out(1)))) {
+		(rtype.NumOut() == 1 && (structElem(rtype.Out(0)) == nil && !typeIsError(rtype.Out(0)))) ||
+		(rtype.NumOut() == 2 && (structElem(rtype.Out(0)) == nil || !typeIsError(rtype.Out(1)))) {
 		panic(errors.New("invalid endpoint interface"))
 	}
 }
@@ -37,135 +57,338 @@ func typeIsStruct(rtype reflect.Type) bool {
 	return rtype.Kind() == reflect.Struct
 }
 
+// structElem returns the struct type of structs and pointers to structs, or nil for other types
+func structElem(rtype reflect.Type) reflect.Type {
+	if rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+	if rtype.Kind() != reflect.Struct {
+		return nil
+	}
+	return rtype
+}
+
 func typeIsError(rtype reflect.Type) bool {
 	return rtype.Implements(reflect.TypeOf((*error)(nil)).Elem())
 }
 
-func (ep *endpoint) setupInputFields() {
-	if ep.rtype.NumIn() == 0 {
-		return
+// setupParams resolves every parameter either to a provider or to the input struct.
+// There can be at most one input struct, and one connection on WebSocket endpoints.
+// The request context can be taken as first parameter.
+// Pointers to structs are taken as input only when they have request tags, so they aren't mistaken for values missing a provider.
+func (ep *endpoint) setupParams(providers map[reflect.Type]reflect.Value) {
+	ep.inIndex = -1
+	ep.connIndex = -1
+	ep.providers = make([]reflect.Value, ep.rtype.NumIn())
+	for i := 0; i < ep.rtype.NumIn(); i++ {
+		param := ep.rtype.In(i)
+		if provider, found := providers[param]; found {
+			ep.providers[i] = provider
+		} else if i == 0 && param == contextType {
+			ep.context = true
+		} else if ep.socket && param == connType && ep.connIndex < 0 {
+			ep.connIndex = i
+		} else if typeIsStruct(param) && ep.inIndex < 0 {
+			ep.inIndex = i
+			ep.inType = param
+		} else if param.Kind() == reflect.Ptr && typeIsStruct(param.Elem()) && len(taggedFields(param.Elem(), "request")) > 0 && ep.inIndex < 0 {
+			ep.inIndex = i
+			ep.inType = param.Elem()
+			ep.inPtr = true
+		} else {
+			panic(errors.New("invalid endpoint interface"))
+		}
 	}
-	ep.inFields = map[string]inputField{}
-	for i := 0; i < ep.rtype.In(0).NumField(); i++ {
-		field := ep.rtype.In(0).Field(i)
-		ep.inFields[field.Name] = newInputField(field)
+}
+
+// setupInputFields type-checks the tags of every input field, returning all problems found
+func (ep *endpoint) setupInputFields() TagErrors {
+	if ep.inType == nil {
+		return nil
 	}
+	return checkFields(ep.name, ep.inType, "request", func(field reflect.StructField) {
+		if unexportedPointer(ep.inType, field.Index) {
+			panic(fieldError{tag: "request", reason: "embedded pointer to unexported struct on input field"})
+		}
+		plan := newInputPlan(field, newInputField(field, ep.app.inputBinders))
+		validation, ok := newFieldValidation(field)
+		ep.inPlans = append(ep.inPlans, plan)
+		if ok {
+			ep.validations = append(ep.validations, validation)
+		}
+	})
 }
 
-func (ep *endpoint) setupOutputFields() {
-	if ep.rtype.NumOut() == 0 || ep.rtype.Out(0).Kind() != reflect.Struct {
-		return
+// checkParams makes sure every param bound by the input is a param of the route path
+func (ep *endpoint) checkParams(segments []segment) TagErrors {
+	if ep.inType == nil {
+		return nil
 	}
-	ep.outFields = map[string]outputField{}
-	for i := 0; i < ep.rtype.Out(0).NumField(); i++ {
-		field := ep.rtype.Out(0).Field(i)
-		ep.outFields[field.Name] = newOutputField(field)
+	params := map[string]bool{}
+	for _, seg := range segments {
+		if seg.param {
+			params[seg.value] = true
+		}
 	}
+	return checkFields(ep.name, ep.inType, "request", func(field reflect.StructField) {
+		tagParts := splitTag(field.Tag.Get("request"))
+		if len(tagParts) >= 2 && tagParts[0] == "param" && !params[tagParts[1]] {
+			panic(fieldError{tag: "request", reason: "param missing from route path on input field"})
+		}
+	})
+}
+
+// setupOutputFields type-checks the tags of every output field, returning all problems found
+func (ep *endpoint) setupOutputFields() TagErrors {
+	if ep.rtype.NumOut() == 0 || structElem(ep.rtype.Out(0)) == nil {
+		return nil
+	}
+	var errs TagErrors
+	ep.outPlans, errs = newOutputPlans(ep.name, structElem(ep.rtype.Out(0)), ep.app.outputWriters)
+	for _, plan := range ep.outPlans {
+		if _, ok := plan.output.(fieldOutput); ok {
+			ep.encodes = true
+		}
+	}
+	return errs
 }
 
 func (ep *endpoint) handle(request *http.Request, httpResponse http.ResponseWriter) {
-	defer ep.writeErrorOnPanic(httpResponse)
-	input := ep.readInput(request)
-	result := ep.rval.Call(input)
-	ep.writeResponse(httpResponse, result)
+	if ep.socket {
+		ep.handleSocket(request, httpResponse)
+		return
+	}
+	closed := request.Context().Done()
+	if ep.timeout > 0 {
+		ctx, cancel := context.WithTimeout(request.Context(), ep.timeout)
+		defer cancel()
+		request = request.WithContext(ctx)
+	}
+	enc, acceptable := negotiate(ep.app.encoders, request.Header.Get("Accept"))
+	defer ep.writeErrorOnPanic(httpResponse, enc)
+	abandoned := false
+	defer func() {
+		if !abandoned {
+			removeUploadedFiles(request)
+		}
+	}()
+	if !acceptable && ep.encodes {
+		ep.app.writeNotAcceptable(httpResponse)
+		return
+	}
+	args, err := ep.readArgs(request)
+	if err != nil {
+		ep.writeError(httpResponse, enc, reflect.ValueOf(err))
+		return
+	}
+	result, ok := ep.call(request.Context(), args, func() { removeUploadedFiles(request) })
+	if !ok {
+		abandoned = true
+		ep.writeError(httpResponse, enc, reflect.ValueOf(errTimeout))
+		return
+	}
+	if ep.timedOut(request.Context(), result) {
+		ep.writeRequestError(httpResponse, enc, errTimeout)
+		return
+	}
+	ep.writeResponse(httpResponse, enc, result, closed)
 }
 
-func (ep *endpoint) readInput(httpRequest *http.Request) []reflect.Value {
-	if ep.rtype.NumIn() == 0 {
-		return nil
+// call runs the endpoint. When it has a timeout, it gives up once ctx is done, leaving the endpoint running on its own
+// and calling release once it returns. Panics are carried over to the caller.
+func (ep *endpoint) call(ctx context.Context, args []reflect.Value, release func()) ([]reflect.Value, bool) {
+	if ep.timeout <= 0 {
+		return ep.rval.Call(args), true
+	}
+	type outcome struct {
+		result []reflect.Value
+		ierr   interface{}
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if ierr := recover(); ierr != nil {
+				done <- outcome{ierr: ierr}
+			}
+		}()
+		done <- outcome{result: ep.rval.Call(args)}
+	}()
+	select {
+	case out := <-done:
+		if out.ierr != nil {
+			panic(out.ierr)
+		}
+		return out.result, true
+	case <-ctx.Done():
+		go func() {
+			<-done
+			release()
+		}()
+		return nil, false
 	}
-	request := newLazyRequest(httpRequest)
-	input := reflect.New(ep.rtype.In(0)).Elem()
-	for name, field := range ep.inFields {
-		target := input.FieldByName(name)
-		target.Set(field.read(request).Convert(target.Type()))
+}
+
+// timedOut tells if the endpoint returned an error wrapping the deadline of the route timeout.
+// Deadlines of other contexts (e.g. of a database driver) are answered as any other error.
+func (ep *endpoint) timedOut(ctx context.Context, result []reflect.Value) bool {
+	if ep.timeout <= 0 || ctx.Err() != context.DeadlineExceeded || len(result) == 0 {
+		return false
 	}
-	return []reflect.Value{input}
+	err, _ := result[len(result)-1].Interface().(error)
+	return errors.Is(err, context.DeadlineExceeded)
 }
 
-func (ep *endpoint) writeResponse(httpResponse http.ResponseWriter, result []reflect.Value) {
+func removeUploadedFiles(request *http.Request) {
+	if request.MultipartForm != nil {
+		request.MultipartForm.RemoveAll()
+	}
+}
+
+func (ep *endpoint) readArgs(request *http.Request) ([]reflect.Value, error) {
+	args := make([]reflect.Value, ep.rtype.NumIn())
+	for i, provider := range ep.providers {
+		if i == ep.inIndex {
+			args[i] = ep.readInput(request)
+			continue
+		}
+		if i == ep.connIndex {
+			continue
+		}
+		if i == 0 && ep.context {
+			args[i] = reflect.ValueOf(request.Context())
+			continue
+		}
+		result := provider.Call([]reflect.Value{reflect.ValueOf(request)})
+		if !result[1].IsNil() {
+			return nil, result[1].Interface().(error)
+		}
+		args[i] = result[0]
+	}
+	return args, nil
+}
+
+func (ep *endpoint) readInput(httpRequest *http.Request) reflect.Value {
+	request := newLazyRequest(httpRequest, ep.app.uploadLimits)
+	input := reflect.New(ep.inType).Elem()
+	for _, plan := range ep.inPlans {
+		plan.assign(fieldByIndex(input, plan.index), plan.input.read(request))
+	}
+	ep.validateInput(input)
+	if ep.inPtr {
+		return input.Addr()
+	}
+	return input
+}
+
+func (ep *endpoint) validateInput(input reflect.Value) {
+	var problems []InputProblem
+	for _, validation := range ep.validations {
+		problems = append(problems, validation.validate(input.FieldByIndex(validation.index))...)
+	}
+	if len(problems) > 0 {
+		violations := make([]string, len(problems))
+		for i, problem := range problems {
+			violations[i] = problem.Key + " " + problem.Reason
+		}
+		panic(RequestError{400, strings.Join(violations, "; "), problems})
+	}
+}
+
+// writeResponse writes the endpoint results. Streamed outputs stop early once done is closed.
+func (ep *endpoint) writeResponse(httpResponse http.ResponseWriter, enc encoder, result []reflect.Value, done <-chan struct{}) {
 	if ep.rtype.NumOut() == 0 {
 		return
 	} else if ep.rtype.NumOut() == 1 {
-		if typeIsStruct(ep.rtype.Out(0)) {
+		if structElem(ep.rtype.Out(0)) != nil {
 			rvOut := result[0]
-			ep.writeOutput(httpResponse, rvOut)
+			ep.writeOutput(httpResponse, enc, rvOut, done)
 		} else if typeIsError(ep.rtype.Out(0)) {
 			rvErr := result[0]
 			if !rvErr.IsNil() {
-				ep.writeError(httpResponse, rvErr.Elem())
+				ep.writeError(httpResponse, enc, rvErr.Elem())
 			}
 		}
 	} else if ep.rtype.NumOut() == 2 {
 		rvOut, rvErr := result[0], result[1]
 		if rvErr.IsNil() {
-			ep.writeOutput(httpResponse, rvOut)
+			ep.writeOutput(httpResponse, enc, rvOut, done)
 		} else {
-			ep.writeError(httpResponse, rvErr.Elem())
+			ep.writeError(httpResponse, enc, rvErr.Elem())
 		}
 	}
 }
 
-func (ep *endpoint) writeOutput(httpResponse http.ResponseWriter, rvOut reflect.Value) {
-	if len(ep.outFields) == 0 {
+func (ep *endpoint) writeOutput(httpResponse http.ResponseWriter, enc encoder, rvOut reflect.Value, done <-chan struct{}) {
+	if len(ep.outPlans) == 0 {
 		return
 	}
-	response := newLazyResponse(httpResponse)
-	for name, field := range ep.outFields {
-		field.write(response, rvOut.FieldByName(name))
+	if rvOut.Kind() == reflect.Ptr {
+		if rvOut.IsNil() {
+			return
+		}
+		rvOut = rvOut.Elem()
+	}
+	response := newLazyResponse(httpResponse, enc)
+	response.done = done
+	for _, plan := range ep.outPlans {
+		if field, ok := lookupField(rvOut, plan.index); ok {
+			plan.output.write(response, field)
+		}
 	}
 	response.send()
 }
 
-func (ep *endpoint) writeError(httpResponse http.ResponseWriter, rvErr reflect.Value) {
-	response := newLazyResponse(httpResponse)
+func (ep *endpoint) writeError(httpResponse http.ResponseWriter, enc encoder, rvErr reflect.Value) {
+	err, _ := rvErr.Interface().(error)
+	if reqErr, ok := asRequestError(err); ok {
+		ep.writeRequestError(httpResponse, enc, reqErr)
+		return
+	}
+	response := newLazyResponse(httpResponse, enc)
 	response.status = 400
-	errFields := getErrorFields(rvErr)
-	if errFields != nil {
-		for name, field := range errFields {
-			field.write(response, rvErr.FieldByName(name))
+	if rvErr = errorStruct(rvErr); isOutputStruct(rvErr) {
+		for _, plan := range ep.app.errorPlans(ep.name, rvErr.Type()) {
+			if field, ok := lookupField(rvErr, plan.index); ok {
+				plan.output.write(response, field)
+			}
 		}
+	} else if ep.app.problemDetails {
+		writeProblem(httpResponse, 400, err.Error(), nil)
+		return
 	} else {
-		response.setJSON("error", rvErr.Interface().(error).Error())
+		response.setField("error", err.Error())
 	}
 	response.send()
 }
 
-func getErrorFields(rvErr reflect.Value) map[string]outputField {
-	rtErr := rvErr.Type()
-	if rtErr.Kind() != reflect.Struct {
-		return nil
-	}
-	errFields := map[string]outputField{}
-	for i := 0; i < rtErr.NumField(); i++ {
-		field := rtErr.Field(i)
-		errFields[field.Name] = newOutputField(field)
-	}
-	return errFields
-}
-
-func (ep *endpoint) writeErrorOnPanic(httpResponse http.ResponseWriter) {
+func (ep *endpoint) writeErrorOnPanic(httpResponse http.ResponseWriter, enc encoder) {
 	ierr := recover()
 	if ierr != nil {
+		if berr, ok := ierr.(bindError); ok {
+			ep.writeError(httpResponse, enc, reflect.ValueOf(berr.err))
+			return
+		}
 		rvErr := reflect.ValueOf(ierr)
-		if isOutputStruct(rvErr) {
-			ep.writeError(httpResponse, rvErr)
+		if _, ok := ierr.(RequestError); ok || isOutputStruct(errorStruct(rvErr)) {
+			ep.writeError(httpResponse, enc, rvErr)
 		} else {
 			panic(ierr)
 		}
 	}
 }
 
+// errorStruct follows a non-nil pointer to its struct, so errors with pointer receivers are written by their tags too
+func errorStruct(rvErr reflect.Value) reflect.Value {
+	if rvErr.Kind() == reflect.Ptr && !rvErr.IsNil() {
+		return rvErr.Elem()
+	}
+	return rvErr
+}
+
 func isOutputStruct(rvStruct reflect.Value) bool {
 	rtStruct := rvStruct.Type()
 	if rtStruct.Kind() != reflect.Struct {
 		return false
 	}
-	for i := 0; i < rtStruct.NumField(); i++ {
-		field := rtStruct.Field(i)
-		if field.Tag.Get("response") != "" {
-			return true
-		}
-	}
-	return false
+	return len(taggedFields(rtStruct, "response")) > 0
 }
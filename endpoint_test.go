@@ -1,24 +1,32 @@
 package gap
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEndpoint(t *testing.T) {
 
 	t.Run("can be constructed from function featuring any one of the accepted interfaces", func(t *testing.T) {
 		defer assertDoesNotPanic(t)
-		newEndpoint(func() {})
-		newEndpoint(func() struct{} { return struct{}{} })
-		newEndpoint(func() error { return nil })
-		newEndpoint(func() (struct{}, error) { return struct{}{}, nil })
-		newEndpoint(func(input struct{}) {})
-		newEndpoint(func(input struct{}) struct{} { return struct{}{} })
-		newEndpoint(func(input struct{}) error { return nil })
-		newEndpoint(func(input struct{}) (struct{}, error) { return struct{}{}, nil })
+		newEndpoint(func() {}, New())
+		newEndpoint(func() struct{} { return struct{}{} }, New())
+		newEndpoint(func() error { return nil }, New())
+		newEndpoint(func() (struct{}, error) { return struct{}{}, nil }, New())
+		newEndpoint(func(input struct{}) {}, New())
+		newEndpoint(func(input struct{}) struct{} { return struct{}{} }, New())
+		newEndpoint(func(input struct{}) error { return nil }, New())
+		newEndpoint(func(input struct{}) (struct{}, error) { return struct{}{}, nil }, New())
+		newEndpoint(func(ctx context.Context, input struct{}) (struct{}, error) { return struct{}{}, nil }, New())
 	})
 
 	t.Run("cannot be constructed from functions with invalid interfaces", func(t *testing.T) {
@@ -29,11 +37,12 @@ func TestEndpoint(t *testing.T) {
 			func() string { return "" },
 			func() (struct{}, struct{}) { return struct{}{}, struct{}{} },
 			func() (error, error) { return nil, nil },
+			func(input struct{}, ctx context.Context) {},
 		}
 		for i, fn := range functions {
 			t.Run(fmt.Sprintf("function %d", i+1), func(t *testing.T) {
 				defer assertPanics(t, "invalid endpoint interface")
-				newEndpoint(fn)
+				newEndpoint(fn, New())
 			})
 		}
 	})
@@ -46,7 +55,7 @@ func TestEndpoint(t *testing.T) {
 			called = true
 			return tOut{}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -68,7 +77,7 @@ func TestEndpoint(t *testing.T) {
 		}
 		for i, fn := range functions {
 			t.Run(fmt.Sprintf("function %d", i+1), func(t *testing.T) {
-				ep := newEndpoint(fn)
+				ep := newEndpoint(fn, New())
 				request := httptest.NewRequest("GET", "/", nil)
 				response := httptest.NewRecorder()
 				ep.handle(request, response)
@@ -110,7 +119,7 @@ func TestEndpoint(t *testing.T) {
 		}
 		for _, tcase := range cases {
 			t.Run(fmt.Sprintf(tcase.name), func(t *testing.T) {
-				ep := newEndpoint(tcase.function)
+				ep := newEndpoint(tcase.function, New())
 				request := httptest.NewRequest("GET", "/", nil)
 				request.Header.Set("user-agent", "test")
 				response := httptest.NewRecorder()
@@ -124,4 +133,222 @@ func TestEndpoint(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("can take and return pointers to structs", func(t *testing.T) {
+		type tIn struct {
+			Name string `request:"query,name"`
+		}
+		type tOut struct {
+			Greeting string `response:"field,greeting"`
+		}
+		ep := newEndpoint(func(input *tIn) (*tOut, error) {
+			if input.Name == "" {
+				return nil, nil
+			}
+			return &tOut{"hello " + input.Name}, nil
+		}, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello?name=ana", nil), response)
+		if response.Code != 200 || response.Body.String() != `{"greeting":"hello ana"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+		response = httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 200 || response.Body.String() != "" {
+			t.Errorf("unexpected response for nil output: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("can take the request context as first parameter", func(t *testing.T) {
+		type tKey struct{}
+		called := false
+		fn := func(ctx context.Context) {
+			called = ctx.Value(tKey{}) == "value"
+		}
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request = request.WithContext(context.WithValue(request.Context(), tKey{}, "value"))
+		ep.handle(request, httptest.NewRecorder())
+		if !called {
+			t.Error("failed to pass request context")
+		}
+	})
+
+	t.Run("timeouts cancel the context and answer service unavailable", func(t *testing.T) {
+		canceled := make(chan bool, 1)
+		fn := func(ctx context.Context) error {
+			<-ctx.Done()
+			canceled <- true
+			return ctx.Err()
+		}
+		ep := newEndpoint(fn, New())
+		ep.timeout = 10 * time.Millisecond
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 503 || response.Body.String() != `{"error":"timeout"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+		if !<-canceled {
+			t.Error("context was not canceled")
+		}
+	})
+
+	t.Run("timeouts answer even if the endpoint ignores the context", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		ep := newEndpoint(func() { <-release }, New())
+		ep.timeout = 10 * time.Millisecond
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 503 {
+			t.Errorf("unexpected status: %d", response.Code)
+		}
+	})
+
+	t.Run("uploads are kept until an abandoned endpoint returns", func(t *testing.T) {
+		type tIn struct {
+			Avatar File `request:"file,avatar"`
+		}
+		release := make(chan struct{})
+		content := make(chan string, 1)
+		fn := func(input tIn) {
+			<-release
+			file, err := input.Avatar.Open()
+			if err != nil {
+				content <- err.Error()
+				return
+			}
+			defer file.Close()
+			data, _ := ioutil.ReadAll(file)
+			content <- string(data)
+		}
+		app := New()
+		app.UploadLimits(1, 1<<20)
+		ep := newEndpoint(fn, app)
+		ep.timeout = 10 * time.Millisecond
+		body, contentType := multipartBody(nil, map[string][]string{"avatar": []string{"avatar.png", "image"}})
+		request := httptest.NewRequest("POST", "/hello", body)
+		request.Header.Set("Content-Type", contentType)
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		close(release)
+		if response.Code != 503 || <-content != "image" {
+			t.Errorf("upload was removed before the endpoint returned: %d", response.Code)
+		}
+	})
+
+	t.Run("endpoints finishing in time answer as usual", func(t *testing.T) {
+		type tOut struct {
+			Message string `response:"json,message"`
+		}
+		ep := newEndpoint(func() tOut { return tOut{"hello"} }, New())
+		ep.timeout = time.Second
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 200 || response.Body.String() != `{"message":"hello"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("deadline errors of the route timeout are answered as timeouts", func(t *testing.T) {
+		fn := func(ctx context.Context) error {
+			<-ctx.Done()
+			return fmt.Errorf("query failed: %w", ctx.Err())
+		}
+		ep := newEndpoint(fn, New())
+		ep.timeout = 10 * time.Millisecond
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 503 || response.Body.String() != `{"error":"timeout"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("other deadline errors are answered as plain errors", func(t *testing.T) {
+		fn := func() error {
+			return fmt.Errorf("query failed: %w", context.DeadlineExceeded)
+		}
+		for _, timeout := range []time.Duration{0, time.Second} {
+			ep := newEndpoint(fn, New())
+			ep.timeout = timeout
+			response := httptest.NewRecorder()
+			ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+			if response.Code != 400 || response.Body.String() != `{"error":"query failed: context deadline exceeded"}` {
+				t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+			}
+		}
+	})
+
+	t.Run("panics on timed endpoints reach the app error handler", func(t *testing.T) {
+		app := New()
+		app.ErrorHandler(func(ierr interface{}, response http.ResponseWriter) {
+			response.WriteHeader(500)
+			fmt.Fprint(response, ierr)
+		})
+		app.Route("GET", "/hello", func() { panic("ops") }).Timeout(time.Second)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/hello", nil))
+		if response.Code != 500 || response.Body.String() != "ops" {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+}
+
+type tBenchInput struct {
+	ID     int    `request:"param,id"`
+	Page   int    `request:"query,page" validate:"min=1"`
+	Auth   string `request:"header,authorization" validate:"required"`
+	Name   string `request:"json,name" validate:"required,max=50"`
+	Active bool   `request:"json,active"`
+}
+
+type tBenchOutput struct {
+	Cache  string `response:"header,Cache-Control"`
+	ID     int    `response:"json,id"`
+	Name   string `response:"json,name"`
+	Active bool   `response:"json,active"`
+}
+
+// discardResponse is a response writer that keeps nothing but headers
+type discardResponse struct {
+	header http.Header
+}
+
+func (response *discardResponse) Header() http.Header            { return response.header }
+func (response *discardResponse) Write(body []byte) (int, error) { return len(body), nil }
+func (response *discardResponse) WriteHeader(status int)         {}
+
+func BenchmarkEndpoint(b *testing.B) {
+	app := New()
+	app.Route("PUT", "/users/{id}", func(input tBenchInput) (tBenchOutput, error) {
+		return tBenchOutput{"no-cache", input.ID, input.Name, input.Active}, nil
+	})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		request := httptest.NewRequest("PUT", "/users/1?page=2", strings.NewReader(`{"name":"Ana","active":true}`))
+		request.Header.Set("Authorization", "token")
+		app.ServeHTTP(&discardResponse{http.Header{}}, request)
+	}
+}
+
+func BenchmarkReadInput(b *testing.B) {
+	ep := newEndpoint(func(input tBenchInput) {}, New())
+	body := strings.NewReader(`{"name":"Ana","active":true}`)
+	request := withRoute(httptest.NewRequest("PUT", "/users/1?page=2", body), "/users/{id}", map[string]string{"id": "1"})
+	request.Header.Set("Authorization", "token")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		body.Seek(0, io.SeekStart)
+		ep.readInput(request)
+	}
+}
+
+func BenchmarkWriteOutput(b *testing.B) {
+	ep := newEndpoint(func() tBenchOutput { return tBenchOutput{} }, New())
+	output := reflect.ValueOf(tBenchOutput{"no-cache", 1, "Ana", true})
+	enc := ep.app.encoders[0]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ep.writeOutput(&discardResponse{http.Header{}}, enc, output, nil)
+	}
 }
@@ -0,0 +1,161 @@
+package gap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// RequestError is answered when the request can't be served as is, e.g. it can't be bound to the endpoint input.
+// Problems describe each offending input value, when they can be pointed out.
+type RequestError struct {
+	Status   int
+	Message  string
+	Problems []InputProblem
+}
+
+func (err RequestError) Error() string {
+	return err.Message
+}
+
+// InputProblem describes what is wrong with a single input value.
+// Source is the kind of input (e.g. query, header, json) and Key is its name, or path for nested json values.
+type InputProblem struct {
+	Source string `json:"source"`
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// asRequestError finds a request error on the chain of err, be it a value or a pointer
+func asRequestError(err error) (RequestError, bool) {
+	var value RequestError
+	if errors.As(err, &value) {
+		return value, true
+	}
+	var pointer *RequestError
+	if errors.As(err, &pointer) && pointer != nil {
+		return *pointer, true
+	}
+	return RequestError{}, false
+}
+
+// errTimeout is answered when the endpoint doesn't finish within the route timeout
+var errTimeout = RequestError{Status: 503, Message: "timeout"}
+
+// newBadRequest creates a request error with a single problem
+func newBadRequest(message string, source string, key string, reason string) RequestError {
+	return RequestError{400, message, []InputProblem{{source, key, reason}}}
+}
+
+func (ep *endpoint) writeRequestError(httpResponse http.ResponseWriter, enc encoder, err RequestError) {
+	if ep.app.problemDetails {
+		writeProblem(httpResponse, err.Status, err.Message, err.Problems)
+		return
+	}
+	response := newLazyResponse(httpResponse, enc)
+	response.status = err.Status
+	response.setField("error", err.Message)
+	if len(err.Problems) > 0 {
+		response.setField("problems", err.Problems)
+	}
+	response.send()
+}
+
+// writeProblem answers with a RFC 7807 problem document
+func writeProblem(httpResponse http.ResponseWriter, status int, detail string, problems []InputProblem) {
+	problem := map[string]interface{}{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	}
+	if len(problems) > 0 {
+		problem["problems"] = problems
+	}
+	body, err := json.Marshal(problem)
+	if err != nil {
+		panic(err)
+	}
+	httpResponse.Header().Set("Content-Type", "application/problem+json")
+	httpResponse.WriteHeader(status)
+	httpResponse.Write(body)
+}
+
+// TagError describes a struct tag that can't be bound to its field, found when routing an endpoint.
+// Expected is the type the tag takes, set when the problem is the field type.
+type TagError struct {
+	Function string
+	Struct   string
+	Field    string
+	Tag      string
+	Type     string
+	Expected string
+	Reason   string
+}
+
+func (err TagError) Error() string {
+	message := fmt.Sprintf("%s: %s.%s `%s`: %s", err.Function, err.Struct, err.Field, err.Tag, err.Reason)
+	if err.Expected != "" {
+		message += fmt.Sprintf(" (expected %s, got %s)", err.Expected, err.Type)
+	}
+	return message
+}
+
+// TagErrors lists every tag error found, one per line
+type TagErrors []TagError
+
+func (errs TagErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// fieldError is panicked while setting up a field, to be reported as a TagError
+type fieldError struct {
+	tag      string
+	reason   string
+	expected string
+}
+
+func (err fieldError) Error() string {
+	if err.expected != "" {
+		return fmt.Sprintf("%s (expected %s)", err.reason, err.expected)
+	}
+	return err.reason
+}
+
+// checkFields runs setup on each field of rtype carrying tag, collecting the errors it panics
+func checkFields(function string, rtype reflect.Type, tag string, setup func(field reflect.StructField)) TagErrors {
+	var errs TagErrors
+	for _, field := range taggedFields(rtype, tag) {
+		if ferr, failed := checkField(field, setup); failed {
+			errs = append(errs, TagError{
+				Function: function,
+				Struct:   rtype.String(),
+				Field:    field.Name,
+				Tag:      fmt.Sprintf(`%s:"%s"`, ferr.tag, field.Tag.Get(ferr.tag)),
+				Type:     field.Type.String(),
+				Expected: ferr.expected,
+				Reason:   ferr.reason,
+			})
+		}
+	}
+	return errs
+}
+
+func checkField(field reflect.StructField, setup func(field reflect.StructField)) (ferr fieldError, failed bool) {
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			if ferr, failed = ierr.(fieldError); !failed {
+				panic(ierr)
+			}
+		}
+	}()
+	setup(field)
+	return
+}
@@ -0,0 +1,262 @@
+package gap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+
+	type tIn struct {
+		Page  int    `request:"query,page"`
+		Title string `request:"json,title" validate:"required"`
+	}
+
+	t.Run("malformed json is answered with where it broke", func(t *testing.T) {
+		ep := newEndpoint(func(input tIn) {}, New())
+		request := httptest.NewRequest("POST", "/hello", strings.NewReader(`{"title": }`))
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		expected := `{"error":"invalid json","problems":[` +
+			`{"source":"json","key":"","reason":"invalid character '}' looking for beginning of value at offset 11"}]}`
+		if response.Code != 400 || response.Body.String() != expected {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("endpoints can return request errors", func(t *testing.T) {
+		fn := func() error {
+			return RequestError{422, "invalid coupon", []InputProblem{{"json", "coupon", "expired"}}}
+		}
+		ep := newEndpoint(fn, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("POST", "/hello", nil), response)
+		expected := `{"error":"invalid coupon","problems":[{"source":"json","key":"coupon","reason":"expired"}]}`
+		if response.Code != 422 || response.Body.String() != expected {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("pointer and wrapped request errors keep their status and problems", func(t *testing.T) {
+		problems := []InputProblem{{"json", "name", "is taken"}}
+		for _, err := range []error{
+			&RequestError{409, "conflict", problems},
+			fmt.Errorf("saving user: %w", RequestError{409, "conflict", problems}),
+		} {
+			err := err
+			ep := newEndpoint(func() error { return err }, New())
+			response := httptest.NewRecorder()
+			ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+			expected := `{"error":"conflict","problems":[{"source":"json","key":"name","reason":"is taken"}]}`
+			if response.Code != 409 || response.Body.String() != expected {
+				t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+			}
+		}
+	})
+
+	t.Run("request errors can be answered as problem details", func(t *testing.T) {
+		app := New()
+		app.ProblemDetails(true)
+		ep := newEndpoint(func(input tIn) {}, app)
+		request := httptest.NewRequest("POST", "/hello?page=two", strings.NewReader(`{}`))
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		expected := `{"detail":"invalid value for query \"page\": expected integer",` +
+			`"problems":[{"source":"query","key":"page","reason":"expected integer"}],` +
+			`"status":400,"title":"Bad Request","type":"about:blank"}`
+		if response.Code != 400 || response.Body.String() != expected {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+		if response.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("unexpected content type: %s", response.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("plain errors can be answered as problem details", func(t *testing.T) {
+		app := New()
+		app.ProblemDetails(true)
+		ep := newEndpoint(func() error { return errors.New("ops") }, app)
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		expected := `{"detail":"ops","status":400,"title":"Bad Request","type":"about:blank"}`
+		if response.Code != 400 || response.Body.String() != expected {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("routing errors are answered as problem details", func(t *testing.T) {
+		app := New()
+		app.ProblemDetails(true)
+		app.Route("GET", "/users", func() struct {
+			Name string `response:"json,name"`
+		} {
+			return struct {
+				Name string `response:"json,name"`
+			}{}
+		})
+		cases := []struct {
+			method string
+			path   string
+			accept string
+			body   string
+		}{
+			{"GET", "/missing", "", `{"detail":"not found","status":404,"title":"Not Found","type":"about:blank"}`},
+			{"POST", "/users", "", `{"detail":"method not allowed","status":405,"title":"Method Not Allowed","type":"about:blank"}`},
+			{"GET", "/users", "text/csv", `{"detail":"not acceptable","status":406,"title":"Not Acceptable","type":"about:blank"}`},
+		}
+		for _, tcase := range cases {
+			request := httptest.NewRequest(tcase.method, tcase.path, nil)
+			request.Header.Set("Accept", tcase.accept)
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, request)
+			if response.Body.String() != tcase.body || response.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("unexpected response: %v %s", response.Header(), response.Body.String())
+			}
+		}
+	})
+
+	t.Run("output struct errors keep their own format on problem details mode", func(t *testing.T) {
+		app := New()
+		app.ProblemDetails(true)
+		ep := newEndpoint(func() error { return tErr{404, "not found"} }, app)
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 404 || response.Body.String() != `{"message":"not found"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("untagged struct errors are answered as plain errors", func(t *testing.T) {
+		ep := newEndpoint(func() error { return tPlainErr{"ops"} }, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 400 || response.Body.String() != `{"error":"ops"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("invalid tags are reported with function, struct, field and expected type", func(t *testing.T) {
+		type tBadIn struct {
+			Body  string `request:"body"`
+			Path  int    `request:"path"`
+			Name  string `request:"query,name" validate:"min"`
+			Valid string `request:"query,valid"`
+		}
+		type tBadOut struct {
+			Status string `response:"status"`
+			Count  int    `response:"header,X-Count"`
+			Other  string `response:"other,x"`
+		}
+		defer func() {
+			errs, ok := recover().(TagErrors)
+			if !ok || len(errs) != 6 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if !strings.HasPrefix(errs[0].Function, "github.com/hugollm/gap.TestErrors.") {
+				t.Errorf("unexpected function: %s", errs[0].Function)
+			}
+			errs[0].Function = ""
+			expected := TagError{"", "gap.tBadIn", "Body", `request:"body"`, "string", "io.Reader", "unsupported type on input field"}
+			if errs[0] != expected {
+				t.Errorf("unexpected error: %#v", errs[0])
+			}
+			messages := strings.Split(errs.Error(), "\n")
+			for i, suffix := range []string{
+				"gap.tBadIn.Body `request:\"body\"`: unsupported type on input field (expected io.Reader, got string)",
+				"gap.tBadIn.Path `request:\"path\"`: unsupported type on input field (expected string, got int)",
+				"gap.tBadIn.Name `validate:\"min\"`: invalid validate tag on input field",
+				"gap.tBadOut.Status `response:\"status\"`: unsupported type on output field (expected int, got string)",
+				"gap.tBadOut.Count `response:\"header,X-Count\"`: unsupported type on output field (expected string, got int)",
+				"gap.tBadOut.Other `response:\"other,x\"`: missing or invalid response tag on output field",
+			} {
+				if !strings.HasSuffix(messages[i], suffix) {
+					t.Errorf("unexpected message: %s", messages[i])
+				}
+			}
+		}()
+		newEndpoint(func(input tBadIn) tBadOut { return tBadOut{} }, New())
+	})
+
+	t.Run("app validation collects invalid tags of declared errors", func(t *testing.T) {
+		type tBadErr struct {
+			tErr
+			Status string `response:"status"`
+		}
+		app := New()
+		app.Route("GET", "/a", func() {}).Errors(tErr{404, "not found"}, errors.New("plain"))
+		if err := app.Validate(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		app.Route("GET", "/b", func() {}).Errors(tBadErr{})
+		app.Route("POST", "/b", func() {}).Errors(tBadErr{})
+		app.Route("PUT", "/b", func() {}).Errors(&tBadErr{})
+		errs, ok := app.Validate().(TagErrors)
+		if !ok || len(errs) != 3 || errs[0].Field != "Status" || errs[0].Expected != "int" {
+			t.Errorf("unexpected errors: %v", errs)
+		}
+	})
+
+	t.Run("params must be part of the route path", func(t *testing.T) {
+		type tParams struct {
+			ID   string `request:"param,id"`
+			Nope string `request:"param,nope"`
+		}
+		app := New()
+		func() {
+			defer assertTagPanics(t, "param missing from route path on input field")
+			app.Route("GET", "/u/{id}", func(input tParams) {})
+		}()
+		defer assertDoesNotPanic(t)
+		app.Route("GET", "/u/{id}/{nope}", func(input tParams) {})
+	})
+
+	t.Run("app validation can collect invalid tags of every endpoint", func(t *testing.T) {
+		type tBadIn struct {
+			Path int `request:"path"`
+		}
+		type tBadOut struct {
+			Status string `response:"status"`
+		}
+		type tBadErr struct {
+			tErr
+			Status string `response:"status"`
+		}
+		app := New()
+		app.CollectTagErrors(true)
+		app.Route("GET", "/a", func(input tBadIn) {})
+		app.Group("/b").Route("GET", "/", func() tBadOut { return tBadOut{} })
+		app.WebSocket("/c", func(conn *Conn, input tBadIn) {})
+		app.Route("GET", "/d", func() {}).Errors(tBadErr{})
+		errs, ok := app.Validate().(TagErrors)
+		if !ok || len(errs) != 4 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		for i, field := range []string{"Path", "Status", "Path", "Status"} {
+			if errs[i].Field != field {
+				t.Errorf("unexpected error: %v", errs[i])
+			}
+		}
+		var handled interface{}
+		app.ErrorHandler(func(ierr interface{}, response http.ResponseWriter) {
+			handled = ierr
+			response.WriteHeader(500)
+		})
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/d", nil))
+		if served, ok := handled.(TagErrors); response.Code != 500 || !ok || len(served) != 3 {
+			t.Errorf("app with tag errors should not serve: %d %v", response.Code, handled)
+		}
+	})
+}
+
+type tPlainErr struct {
+	message string
+}
+
+func (err tPlainErr) Error() string {
+	return err.message
+}
@@ -0,0 +1,138 @@
+// Package gaptest provides a client for testing apps without a network.
+//
+//	gaptest.New(app).GET("/users/1").Header("Authorization", "token").Do().
+//		AssertStatus(t, 200).
+//		AssertJSON(t, "user.name", "Ana")
+package gaptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+)
+
+// Client sends requests straight to a handler, usually a *gap.App
+type Client struct {
+	handler http.Handler
+	header  http.Header
+}
+
+// New creates a client for handler
+func New(handler http.Handler) *Client {
+	return &Client{handler, http.Header{}}
+}
+
+// Header sets a header sent on every request made by the client (e.g. Authorization)
+func (client *Client) Header(key string, value string) *Client {
+	client.header.Set(key, value)
+	return client
+}
+
+// GET starts a GET request to path
+func (client *Client) GET(path string) *Request {
+	return client.Request("GET", path)
+}
+
+// POST starts a POST request to path
+func (client *Client) POST(path string) *Request {
+	return client.Request("POST", path)
+}
+
+// PUT starts a PUT request to path
+func (client *Client) PUT(path string) *Request {
+	return client.Request("PUT", path)
+}
+
+// PATCH starts a PATCH request to path
+func (client *Client) PATCH(path string) *Request {
+	return client.Request("PATCH", path)
+}
+
+// DELETE starts a DELETE request to path
+func (client *Client) DELETE(path string) *Request {
+	return client.Request("DELETE", path)
+}
+
+// Request starts a request with any method. The path may contain a query string.
+func (client *Client) Request(method string, path string) *Request {
+	return &Request{client: client, method: method, path: path, header: client.header.Clone(), query: url.Values{}}
+}
+
+// Request is built with chained calls and sent with Do
+type Request struct {
+	client  *Client
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    io.Reader
+}
+
+// Header sets a request header
+func (request *Request) Header(key string, value string) *Request {
+	request.header.Set(key, value)
+	return request
+}
+
+// Query adds a value to the query string
+func (request *Request) Query(key string, value string) *Request {
+	request.query.Add(key, value)
+	return request
+}
+
+// Cookie adds a cookie to the request
+func (request *Request) Cookie(name string, value string) *Request {
+	request.cookies = append(request.cookies, &http.Cookie{Name: name, Value: value})
+	return request
+}
+
+// JSON encodes value as the request body. It panics if value can't be encoded.
+func (request *Request) JSON(value interface{}) *Request {
+	body, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	request.header.Set("Content-Type", "application/json")
+	request.body = bytes.NewReader(body)
+	return request
+}
+
+// Form sends values as an urlencoded form body
+func (request *Request) Form(values url.Values) *Request {
+	request.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.body = strings.NewReader(values.Encode())
+	return request
+}
+
+// Body sends a raw request body
+func (request *Request) Body(body io.Reader) *Request {
+	request.body = body
+	return request
+}
+
+// Do sends the request to the handler, returning the recorded response
+func (request *Request) Do() *Response {
+	target := request.path
+	if len(request.query) > 0 {
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+		target += separator + request.query.Encode()
+	}
+	httpRequest := httptest.NewRequest(request.method, target, request.body)
+	for key, values := range request.header {
+		httpRequest.Header[key] = values
+	}
+	for _, cookie := range request.cookies {
+		httpRequest.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	request.client.handler.ServeHTTP(recorder, httpRequest)
+	return &Response{recorder.Code, recorder.Result().Header, recorder.Body.Bytes()}
+}
@@ -0,0 +1,86 @@
+package gaptest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hugollm/gap"
+)
+
+func TestClient(t *testing.T) {
+
+	type tIn struct {
+		ID      int    `request:"param,id"`
+		Fields  string `request:"query,fields"`
+		Auth    string `request:"header,authorization"`
+		Tenant  string `request:"header,x-tenant"`
+		Session string `request:"cookie,session"`
+		Name    string `request:"json,name"`
+	}
+	type tOut struct {
+		Echo tIn `response:"json,echo"`
+	}
+	app := gap.New()
+	app.Route("PUT", "/users/{id}", func(input tIn) tOut { return tOut{input} })
+	client := New(app).Header("Authorization", "token")
+
+	t.Run("sends request built with chained calls", func(t *testing.T) {
+		response := client.PUT("/users/1").
+			Header("X-Tenant", "acme").
+			Query("fields", "name").
+			Cookie("session", "abc").
+			JSON(map[string]string{"name": "Ana"}).
+			Do()
+		expected := `{"echo":{"ID":1,"Fields":"name","Auth":"token","Tenant":"acme","Session":"abc","Name":"Ana"}}`
+		if response.Status != 200 || string(response.Body) != expected {
+			t.Errorf("unexpected response: %d %s", response.Status, response.Body)
+		}
+	})
+
+	t.Run("appends query values to the ones on the path", func(t *testing.T) {
+		app := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			response.Write([]byte(request.URL.RawQuery))
+		})
+		response := New(app).GET("/users?a=1").Query("b", "2").Do()
+		if string(response.Body) != "a=1&b=2" {
+			t.Errorf("unexpected query: %s", response.Body)
+		}
+	})
+
+	t.Run("can send forms and raw bodies", func(t *testing.T) {
+		echo := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			body, _ := ioutil.ReadAll(request.Body)
+			response.Write([]byte(request.Header.Get("Content-Type") + " " + string(body)))
+		})
+		response := New(echo).POST("/").Form(url.Values{"name": {"Ana"}}).Do()
+		if string(response.Body) != "application/x-www-form-urlencoded name=Ana" {
+			t.Errorf("unexpected body: %s", response.Body)
+		}
+		response = New(echo).PATCH("/").Header("Content-Type", "text/plain").Body(strings.NewReader("lorem")).Do()
+		if string(response.Body) != "text/plain lorem" {
+			t.Errorf("unexpected body: %s", response.Body)
+		}
+	})
+
+	t.Run("client headers are not changed by requests", func(t *testing.T) {
+		client.GET("/").Header("Authorization", "other")
+		if client.header.Get("Authorization") != "token" {
+			t.Error("client header was changed")
+		}
+	})
+
+	t.Run("responses only hold headers sent with the status", func(t *testing.T) {
+		late := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			response.Header().Set("X-Sent", "yes")
+			response.WriteHeader(201)
+			response.Header().Set("X-Late", "yes")
+		})
+		response := New(late).GET("/").Do()
+		if response.Status != 201 || response.Header.Get("X-Sent") != "yes" || response.Header.Get("X-Late") != "" {
+			t.Errorf("unexpected response: %d %v", response.Status, response.Header)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package gaptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Response is what the handler answered. Assertions report failures on t and return the response, so they can be chained.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// AssertStatus checks the response status code
+func (response *Response) AssertStatus(t testing.TB, status int) *Response {
+	t.Helper()
+	if response.Status != status {
+		t.Errorf("expected status %d, got %d: %s", status, response.Status, response.Body)
+	}
+	return response
+}
+
+// AssertHeader checks the value of a response header
+func (response *Response) AssertHeader(t testing.TB, key string, value string) *Response {
+	t.Helper()
+	if actual := response.Header.Get(key); actual != value {
+		t.Errorf("expected header %s to be %q, got %q", key, value, actual)
+	}
+	return response
+}
+
+// AssertBody checks the whole response body
+func (response *Response) AssertBody(t testing.TB, body string) *Response {
+	t.Helper()
+	if string(response.Body) != body {
+		t.Errorf("expected body %q, got %q", body, response.Body)
+	}
+	return response
+}
+
+// AssertJSON checks the value at a path of the JSON body.
+// Path segments are separated by dots, with array items referred to by index (e.g. users.0.name).
+// Values are compared by their JSON encoding, so numbers of any type match.
+func (response *Response) AssertJSON(t testing.TB, path string, expected interface{}) *Response {
+	t.Helper()
+	actual, err := response.JSON(path)
+	if err != nil {
+		t.Errorf("%s: %s", path, err)
+		return response
+	}
+	normalized, err := normalize(expected)
+	if err != nil {
+		t.Errorf("%s: can't encode expected value: %s", path, err)
+		return response
+	}
+	if !reflect.DeepEqual(actual, normalized) {
+		t.Errorf("expected %s to be %s, got %s", path, encode(normalized), encode(actual))
+	}
+	return response
+}
+
+// JSON returns the value at a path of the JSON body (see AssertJSON). An empty path returns the whole body.
+func (response *Response) JSON(path string) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(response.Body, &value); err != nil {
+		return nil, fmt.Errorf("invalid json body: %s", err)
+	}
+	if path == "" {
+		return value, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			item, found := v[key]
+			if !found {
+				return nil, fmt.Errorf("missing key %q", key)
+			}
+			value = item
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("missing index %q", key)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("missing key %q", key)
+		}
+	}
+	return value, nil
+}
+
+// DecodeJSON decodes the JSON body into value
+func (response *Response) DecodeJSON(value interface{}) error {
+	return json.Unmarshal(response.Body, value)
+}
+
+// AssertGolden compares the response (status, headers and body) against a golden file.
+// The file is only written when the GAPTEST_UPDATE environment variable is set, so missing files fail the test.
+// JSON bodies are indented, so changes are easy to review.
+func (response *Response) AssertGolden(t testing.TB, path string) *Response {
+	t.Helper()
+	snapshot := response.snapshot()
+	if os.Getenv("GAPTEST_UPDATE") != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("can't write golden file: %s", err)
+			return response
+		}
+		if err := ioutil.WriteFile(path, snapshot, 0644); err != nil {
+			t.Errorf("can't write golden file: %s", err)
+			return response
+		}
+		t.Logf("golden file written: %s", path)
+		return response
+	}
+	expected, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Errorf("missing golden file %s (run with GAPTEST_UPDATE=1 to write it)", path)
+	} else if err != nil {
+		t.Errorf("can't read golden file: %s", err)
+	} else if !bytes.Equal(expected, snapshot) {
+		t.Errorf("response doesn't match golden file %s\n--- expected\n%s\n--- actual\n%s", path, expected, snapshot)
+	}
+	return response
+}
+
+func (response *Response) snapshot() []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%d %s\n", response.Status, http.StatusText(response.Status))
+	keys := make([]string, 0, len(response.Header))
+	for key := range response.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range response.Header[key] {
+			fmt.Fprintf(buf, "%s: %s\n", key, value)
+		}
+	}
+	buf.WriteString("\n")
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	indented := &bytes.Buffer{}
+	if strings.HasSuffix(mediaType, "json") && json.Indent(indented, response.Body, "", "  ") == nil {
+		buf.Write(indented.Bytes())
+		buf.WriteString("\n")
+	} else {
+		buf.Write(response.Body)
+	}
+	return buf.Bytes()
+}
+
+// normalize reduces value to the types produced by decoding JSON
+func normalize(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	err = json.Unmarshal(encoded, &normalized)
+	return normalized, err
+}
+
+func encode(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
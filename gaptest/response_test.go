@@ -0,0 +1,117 @@
+package gaptest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recorder collects failures instead of failing the test
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Logf(format string, args ...interface{}) {}
+
+func TestResponse(t *testing.T) {
+
+	response := &Response{
+		Status: 200,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   []byte(`{"user":{"id":1,"name":"Ana","tags":["admin","staff"]}}`),
+	}
+
+	t.Run("passing assertions report nothing", func(t *testing.T) {
+		r := &recorder{}
+		response.AssertStatus(r, 200).
+			AssertHeader(r, "Content-Type", "application/json").
+			AssertJSON(r, "user.id", 1).
+			AssertJSON(r, "user.tags.1", "staff").
+			AssertJSON(r, "user.tags", []string{"admin", "staff"}).
+			AssertBody(r, `{"user":{"id":1,"name":"Ana","tags":["admin","staff"]}}`)
+		if len(r.errors) > 0 {
+			t.Errorf("unexpected failures: %v", r.errors)
+		}
+	})
+
+	t.Run("failing assertions report what was expected", func(t *testing.T) {
+		r := &recorder{}
+		response.AssertStatus(r, 201).
+			AssertHeader(r, "Content-Type", "text/plain").
+			AssertJSON(r, "user.name", "Bia").
+			AssertJSON(r, "user.email", "x").
+			AssertJSON(r, "user.tags.2", "x").
+			AssertBody(r, `{}`)
+		expected := []string{
+			`expected status 201, got 200: {"user":{"id":1,"name":"Ana","tags":["admin","staff"]}}`,
+			`expected header Content-Type to be "text/plain", got "application/json"`,
+			`expected user.name to be "Bia", got "Ana"`,
+			`user.email: missing key "email"`,
+			`user.tags.2: missing index "2"`,
+			`expected body "{}", got "{\"user\":{\"id\":1,\"name\":\"Ana\",\"tags\":[\"admin\",\"staff\"]}}"`,
+		}
+		if strings.Join(r.errors, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("unexpected failures:\n%s", strings.Join(r.errors, "\n"))
+		}
+	})
+
+	t.Run("can decode json body", func(t *testing.T) {
+		var body struct {
+			User struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		}
+		if err := response.DecodeJSON(&body); err != nil || body.User.Name != "Ana" {
+			t.Errorf("unexpected body: %+v %v", body, err)
+		}
+	})
+
+	t.Run("fails on missing golden files and compares existing ones", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "testdata", "user.golden")
+		r := &recorder{}
+		response.AssertGolden(r, path)
+		if len(r.errors) != 1 || !strings.HasPrefix(r.errors[0], "missing golden file") {
+			t.Errorf("unexpected failures: %v", r.errors)
+		}
+		os.Setenv("GAPTEST_UPDATE", "1")
+		response.AssertGolden(r, path)
+		os.Unsetenv("GAPTEST_UPDATE")
+		written, _ := ioutil.ReadFile(path)
+		expected := "200 OK\nContent-Type: application/json\n\n" +
+			"{\n  \"user\": {\n    \"id\": 1,\n    \"name\": \"Ana\",\n    \"tags\": [\n      \"admin\",\n      \"staff\"\n    ]\n  }\n}\n"
+		if string(written) != expected {
+			t.Errorf("unexpected golden file: %q", written)
+		}
+		r = &recorder{}
+		response.AssertGolden(r, path)
+		changed := &Response{Status: 404, Header: http.Header{}, Body: []byte("not found")}
+		changed.AssertGolden(r, path)
+		if len(r.errors) != 1 || !strings.HasPrefix(r.errors[0], "response doesn't match golden file") {
+			t.Errorf("unexpected failures: %v", r.errors)
+		}
+	})
+
+	t.Run("updates golden files when asked to", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "user.golden")
+		ioutil.WriteFile(path, []byte("old"), 0644)
+		os.Setenv("GAPTEST_UPDATE", "1")
+		defer os.Unsetenv("GAPTEST_UPDATE")
+		r := &recorder{}
+		(&Response{Status: 204, Header: http.Header{}}).AssertGolden(r, path)
+		written, _ := ioutil.ReadFile(path)
+		if len(r.errors) > 0 || string(written) != "204 No Content\n\n" {
+			t.Errorf("unexpected golden file: %q %v", written, r.errors)
+		}
+	})
+}
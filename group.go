@@ -0,0 +1,66 @@
+package gap
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Group is a set of routes sharing a path prefix and middleware.
+// Its routes are registered on the App, just like the ones added to it directly.
+type Group struct {
+	app        *App
+	parent     *Group
+	prefix     string
+	middleware []Middleware
+}
+
+func newGroup(app *App, parent *Group, prefix string, middleware []Middleware) *Group {
+	if prefix != "" && (!strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/")) {
+		panic(errors.New("invalid group prefix"))
+	}
+	return &Group{app, parent, prefix, middleware}
+}
+
+// Route binds request method and path, prefixed by the group, to target endpoint.
+// Group middleware wraps the route middleware.
+func (group *Group) Route(method string, path string, fn interface{}, middleware ...Middleware) *Route {
+	return group.app.addRoute(method, group.path(path), newEndpoint(fn, group.app), middleware, group)
+}
+
+// WebSocket routes GET requests on path, prefixed by the group, to a WebSocket endpoint (see App.WebSocket)
+func (group *Group) WebSocket(path string, fn interface{}, middleware ...Middleware) *Route {
+	return group.app.addRoute("GET", group.path(path), newSocketEndpoint(fn, group.app), middleware, group)
+}
+
+// Group creates a nested group, with prefix and middleware added to the ones of this group
+func (group *Group) Group(prefix string, middleware ...Middleware) *Group {
+	return newGroup(group.app, group, prefix, middleware)
+}
+
+// Use adds middleware to every route in the group, including nested groups
+func (group *Group) Use(middleware ...Middleware) {
+	group.middleware = append(group.middleware, middleware...)
+	atomic.AddInt32(&group.app.chainVersion, 1)
+}
+
+// path prefixes path with the prefixes of every group. A path of "/" stands for the bare prefix.
+func (group *Group) path(path string) string {
+	prefix := ""
+	for g := group; g != nil; g = g.parent {
+		prefix = g.prefix + prefix
+	}
+	if path == "/" && prefix != "" {
+		return prefix
+	}
+	return prefix + path
+}
+
+// wrap applies middleware from the outermost group inwards. A nil group has no middleware.
+func (group *Group) wrap(handler http.Handler) http.Handler {
+	for g := group; g != nil; g = g.parent {
+		handler = chain(g.middleware, handler)
+	}
+	return handler
+}
@@ -0,0 +1,112 @@
+package gap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+
+	trace := func(name string, calls *[]string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				*calls = append(*calls, name)
+				next.ServeHTTP(response, request)
+			})
+		}
+	}
+
+	t.Run("routes are registered with the group prefix", func(t *testing.T) {
+		type tIn struct {
+			ID string `request:"param,id"`
+		}
+		type tOut struct {
+			ID string `response:"json,id"`
+		}
+		app := New()
+		api := app.Group("/api/v1")
+		api.Route("GET", "/users/{id}", func(input tIn) tOut { return tOut{input.ID} })
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/api/v1/users/42", nil))
+		if response.Body.String() != `{"id":"42"}` {
+			t.Errorf("failed to route group path: %s", response.Body.String())
+		}
+		response = httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/users/42", nil))
+		if response.Code != 404 {
+			t.Error("route should only be reachable with prefix")
+		}
+	})
+
+	t.Run("root path of a group is the bare prefix", func(t *testing.T) {
+		app := New()
+		app.Group("/api").Group("/v1").Route("GET", "/", func() {})
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/api/v1", nil))
+		if response.Code != 200 {
+			t.Errorf("failed to route group root: %d", response.Code)
+		}
+		response = httptest.NewRecorder()
+		app.Group("").Route("GET", "/", func() {})
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		if response.Code != 200 {
+			t.Errorf("failed to route root of empty group: %d", response.Code)
+		}
+	})
+
+	t.Run("groups can be nested", func(t *testing.T) {
+		app := New()
+		admin := app.Group("/api").Group("/v1").Group("/admin")
+		admin.Route("GET", "/stats", func() {})
+		if len(app.paths) != 1 || app.paths[0].path != "/api/v1/admin/stats" {
+			t.Errorf("unexpected paths: %v", app.paths)
+		}
+	})
+
+	t.Run("group middleware wraps routes from outer to inner groups", func(t *testing.T) {
+		calls := []string{}
+		app := New()
+		app.Use(trace("app", &calls))
+		api := app.Group("/api", trace("api", &calls))
+		admin := api.Group("/admin", trace("admin", &calls))
+		admin.Route("GET", "/stats", func() { calls = append(calls, "endpoint") }, trace("route", &calls))
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/admin/stats", nil))
+		if strings.Join(calls, ",") != "app,api,admin,route,endpoint" {
+			t.Errorf("unexpected call order: %v", calls)
+		}
+	})
+
+	t.Run("group middleware added later applies to existing routes", func(t *testing.T) {
+		calls := []string{}
+		app := New()
+		api := app.Group("/api")
+		api.Route("GET", "/hello", func() {})
+		api.Use(trace("api", &calls))
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/hello", nil))
+		if len(calls) != 1 {
+			t.Errorf("unexpected calls: %v", calls)
+		}
+	})
+
+	t.Run("group middleware does not apply outside the group", func(t *testing.T) {
+		calls := []string{}
+		app := New()
+		app.Group("/api", trace("api", &calls)).Route("GET", "/hello", func() {})
+		app.Route("GET", "/hello", func() {})
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+		if len(calls) != 0 {
+			t.Errorf("unexpected calls: %v", calls)
+		}
+	})
+
+	t.Run("rejects invalid prefixes", func(t *testing.T) {
+		for _, prefix := range []string{"api", "/api/"} {
+			t.Run(prefix, func(t *testing.T) {
+				defer assertPanics(t, "invalid group prefix")
+				New().Group(prefix)
+			})
+		}
+	})
+}
@@ -26,3 +26,14 @@ func assertPanics(t *testing.T, msg string) {
 		}
 	}
 }
+
+// assertTagPanics checks that routing panicked with tag errors, the first one for reason
+func assertTagPanics(t *testing.T, reason string) {
+	ierr := recover()
+	errs, ok := ierr.(TagErrors)
+	if !ok {
+		t.Errorf("did not panic with tag errors: %v", ierr)
+	} else if errs[0].Reason != reason {
+		t.Errorf(`panic reason was wrong: "%s"`, errs[0].Reason)
+	}
+}
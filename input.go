@@ -1,33 +1,175 @@
 package gap
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
+	"io"
 	"reflect"
 	"strings"
 )
 
+var readCloserType = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+
 type inputField interface {
 	read(request *lazyRequest) reflect.Value
 }
 
-func newInputField(field reflect.StructField) inputField {
+// parseableTypes describes the field types request strings can be parsed into
+const parseableTypes = "string, bool, number, time, duration or encoding.TextUnmarshaler"
+
+// optionSources are the kinds of input taking options after the key (e.g. request:"query,page,default=1")
+var optionSources = map[string]bool{"header": true, "param": true, "query": true, "form": true, "cookie": true}
+
+func newInputField(field reflect.StructField, binders map[string]InputBinder) inputField {
 	tagParts := splitTag(field.Tag.Get("request"))
+	var options inputOptions
+	if len(tagParts) > 2 && optionSources[tagParts[0]] {
+		options = newInputOptions(tagParts[2:], field.Type)
+		tagParts = tagParts[:2]
+	}
+	if len(tagParts) == 2 && (tagParts[0] == "header" || tagParts[0] == "query" || tagParts[0] == "form") &&
+		!canParseString(field.Type) {
+		if isParseableSlice(field.Type) {
+			return multiInput{tagParts[0], tagParts[1], field.Type, options}
+		}
+		if tagParts[0] == "query" {
+			return newDeepObjectInput(tagParts[1], field.Type, options)
+		}
+		panic(unsupportedInput(parseableTypes + ", or slices of them"))
+	}
+	if len(tagParts) == 2 && tagParts[0] == "param" && !canParseString(field.Type) {
+		panic(unsupportedInput(parseableTypes))
+	}
+	if len(tagParts) == 2 && tagParts[0] == "cookie" {
+		if field.Type != cookieType && field.Type != cookiePtrType && !canParseString(field.Type) {
+			panic(unsupportedInput("http.Cookie, *http.Cookie or " + parseableTypes))
+		}
+		return cookieInput{tagParts[1], field.Type, options}
+	}
+	if len(tagParts) == 2 && tagParts[0] == "file" &&
+		field.Type != fileType && field.Type != filePtrType && field.Type != fileSliceType {
+		panic(unsupportedInput("gap.File, *gap.File or []gap.File"))
+	}
 	if len(tagParts) == 2 && tagParts[0] == "header" {
-		return headerInput{tagParts[1]}
+		return headerInput{tagParts[1], field.Type, options}
 	}
 	if len(tagParts) == 1 && tagParts[0] == "path" {
+		if field.Type.Kind() != reflect.String {
+			panic(unsupportedInput("string"))
+		}
 		return pathInput{}
 	}
+	if len(tagParts) == 2 && tagParts[0] == "param" {
+		return paramInput{tagParts[1], field.Type, options}
+	}
 	if len(tagParts) == 2 && tagParts[0] == "query" {
-		return queryInput{tagParts[1]}
+		return queryInput{tagParts[1], field.Type, options}
 	}
 	if len(tagParts) == 2 && tagParts[0] == "json" {
-		return jsonInput{tagParts[1]}
+		return jsonInput{tagParts[1], field.Type}
+	}
+	if len(tagParts) == 1 && tagParts[0] == "json" {
+		return jsonBodyInput{field.Type}
+	}
+	if len(tagParts) == 2 && tagParts[0] == "form" {
+		return formInput{tagParts[1], field.Type, options}
+	}
+	if len(tagParts) == 2 && tagParts[0] == "file" {
+		return fileInput{tagParts[1], field.Type}
 	}
 	if len(tagParts) == 1 && tagParts[0] == "body" {
+		if field.Type.Kind() != reflect.Interface || !readCloserType.Implements(field.Type) {
+			panic(unsupportedInput("io.Reader"))
+		}
 		return bodyInput{}
 	}
-	panic(errors.New("missing or invalid request tag on input field"))
+	if binder, found := binders[tagParts[0]]; found && len(tagParts) <= 2 {
+		key := ""
+		if len(tagParts) == 2 {
+			key = tagParts[1]
+		}
+		return customInput{tagParts[0], key, field.Type, binder}
+	}
+	panic(fieldError{tag: "request", reason: "missing or invalid request tag on input field"})
+}
+
+func unsupportedInput(expected string) fieldError {
+	return fieldError{"request", "unsupported type on input field", expected}
+}
+
+// inputOptions tell what to do with absent values: answer bad request if required, or use a default
+type inputOptions struct {
+	required   bool
+	hasDefault bool
+	fallback   string
+	comma      bool
+}
+
+func newInputOptions(options []string, rtype reflect.Type) inputOptions {
+	var parsed inputOptions
+	for _, option := range options {
+		switch {
+		case option == "required":
+			parsed.required = true
+		case option == "comma" && isParseableSlice(rtype):
+			parsed.comma = true
+		case strings.HasPrefix(option, "default="):
+			parsed.hasDefault = true
+			parsed.fallback = strings.TrimPrefix(option, "default=")
+			itemType := rtype
+			if isParseableSlice(rtype) {
+				itemType = rtype.Elem()
+			}
+			if !canParseString(itemType) {
+				panic(fieldError{tag: "request", reason: "invalid default on input field"})
+			}
+			if _, err := parseString(parsed.fallback, itemType); err != nil {
+				panic(fieldError{tag: "request", reason: "invalid default on input field: " + err.Error()})
+			}
+		default:
+			panic(fieldError{tag: "request", reason: "invalid option on input field"})
+		}
+	}
+	if parsed.required && parsed.hasDefault {
+		panic(fieldError{tag: "request", reason: "invalid option on input field: required inputs can't have a default"})
+	}
+	return parsed
+}
+
+// parse applies the options to an optional request string, before converting it to rtype
+func (options inputOptions) parse(raw string, found bool, rtype reflect.Type, source string, key string) reflect.Value {
+	if !found && options.required {
+		panic(missingInput(source, key))
+	}
+	if !found && options.hasDefault {
+		raw, found = options.fallback, true
+	}
+	return parseInput(raw, found, rtype, source, key)
+}
+
+// values applies the options to the values given for a key, splitting them if they are comma separated.
+// Absent values yield nil.
+func (options inputOptions) values(values []string, source string, key string) []string {
+	if len(values) == 0 && options.required {
+		panic(missingInput(source, key))
+	}
+	if len(values) == 0 && options.hasDefault {
+		values = []string{options.fallback}
+	}
+	if !options.comma {
+		return values
+	}
+	split := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			split = append(split, strings.TrimSpace(item))
+		}
+	}
+	return split
+}
+
+func missingInput(source string, key string) RequestError {
+	return newBadRequest(fmt.Sprintf(`missing %s "%s"`, source, key), source, key, "is required")
 }
 
 func splitTag(tag string) []string {
@@ -39,11 +181,17 @@ func splitTag(tag string) []string {
 }
 
 type headerInput struct {
-	key string
+	key     string
+	rtype   reflect.Type
+	options inputOptions
 }
 
 func (input headerInput) read(request *lazyRequest) reflect.Value {
-	return reflect.ValueOf(request.httpRequest.Header.Get(input.key))
+	values := request.httpRequest.Header.Values(input.key)
+	if len(values) == 0 {
+		return input.options.parse("", false, input.rtype, "header", input.key)
+	}
+	return input.options.parse(values[0], true, input.rtype, "header", input.key)
 }
 
 type pathInput struct{}
@@ -52,20 +200,141 @@ func (input pathInput) read(request *lazyRequest) reflect.Value {
 	return reflect.ValueOf(request.httpRequest.URL.Path)
 }
 
+type paramInput struct {
+	key     string
+	rtype   reflect.Type
+	options inputOptions
+}
+
+func (input paramInput) read(request *lazyRequest) reflect.Value {
+	value, found := getParams(request.httpRequest)[input.key]
+	return input.options.parse(value, found, input.rtype, "param", input.key)
+}
+
 type queryInput struct {
-	key string
+	key     string
+	rtype   reflect.Type
+	options inputOptions
 }
 
 func (input queryInput) read(request *lazyRequest) reflect.Value {
-	return reflect.ValueOf(request.getQuery(input.key))
+	value, found := request.getQuery(input.key)
+	return input.options.parse(value, found, input.rtype, "query", input.key)
 }
 
 type jsonInput struct {
-	key string
+	key   string
+	rtype reflect.Type
 }
 
 func (input jsonInput) read(request *lazyRequest) reflect.Value {
-	return reflect.ValueOf(request.getJSON(input.key))
+	raw, found := request.getJSON(input.key)
+	if !found {
+		return reflect.Zero(input.rtype)
+	}
+	return decodeJSON(raw, input.rtype, input.key)
+}
+
+type jsonBodyInput struct {
+	rtype reflect.Type
+}
+
+func (input jsonBodyInput) read(request *lazyRequest) reflect.Value {
+	return decodeJSON(request.getJSONBody(), input.rtype, "")
+}
+
+func decodeJSON(raw []byte, rtype reflect.Type, key string) reflect.Value {
+	value := reflect.New(rtype)
+	err := json.Unmarshal(raw, value.Interface())
+	if err == nil {
+		return value.Elem()
+	}
+	reason := err.Error()
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		key = joinJSONPath(key, typeErr.Field)
+		reason = "expected " + typeErr.Type.String()
+	}
+	if key == "" {
+		panic(newBadRequest("invalid json: "+reason, "json", "", reason))
+	}
+	panic(newBadRequest(fmt.Sprintf(`invalid value for json "%s": %s`, key, reason), "json", key, reason))
+}
+
+func joinJSONPath(key string, path string) string {
+	if key == "" {
+		return path
+	}
+	if path == "" {
+		return key
+	}
+	return key + "." + path
+}
+
+type cookieInput struct {
+	key     string
+	rtype   reflect.Type
+	options inputOptions
+}
+
+func (input cookieInput) read(request *lazyRequest) reflect.Value {
+	cookie, err := request.httpRequest.Cookie(input.key)
+	if err != nil && input.options.required {
+		panic(missingInput("cookie", input.key))
+	}
+	if input.rtype == cookiePtrType {
+		if err != nil {
+			return reflect.Zero(input.rtype)
+		}
+		return reflect.ValueOf(cookie)
+	}
+	if input.rtype == cookieType {
+		if err != nil {
+			return reflect.Zero(input.rtype)
+		}
+		return reflect.ValueOf(*cookie)
+	}
+	if err != nil {
+		return input.options.parse("", false, input.rtype, "cookie", input.key)
+	}
+	return input.options.parse(cookie.Value, true, input.rtype, "cookie", input.key)
+}
+
+type formInput struct {
+	key     string
+	rtype   reflect.Type
+	options inputOptions
+}
+
+func (input formInput) read(request *lazyRequest) reflect.Value {
+	values := request.getForm().Value[input.key]
+	if len(values) == 0 {
+		return input.options.parse("", false, input.rtype, "form", input.key)
+	}
+	return input.options.parse(values[0], true, input.rtype, "form", input.key)
+}
+
+type fileInput struct {
+	key   string
+	rtype reflect.Type
+}
+
+func (input fileInput) read(request *lazyRequest) reflect.Value {
+	headers := request.getForm().File[input.key]
+	if input.rtype == fileSliceType {
+		files := make([]File, len(headers))
+		for i, header := range headers {
+			files[i] = newFile(header)
+		}
+		return reflect.ValueOf(files)
+	}
+	if len(headers) == 0 {
+		return reflect.Zero(input.rtype)
+	}
+	file := newFile(headers[0])
+	if input.rtype == filePtrType {
+		return reflect.ValueOf(&file)
+	}
+	return reflect.ValueOf(file)
 }
 
 type bodyInput struct{}
@@ -73,3 +342,124 @@ type bodyInput struct{}
 func (input bodyInput) read(request *lazyRequest) reflect.Value {
 	return reflect.ValueOf(request.httpRequest.Body)
 }
+
+// isParseableSlice tells if rtype is a slice of items request strings can be parsed into
+func isParseableSlice(rtype reflect.Type) bool {
+	return rtype.Kind() == reflect.Slice && !canParseString(rtype) && canParseString(rtype.Elem())
+}
+
+// parseSlice converts every value to an item of a slice of rtype.
+// Empty values are skipped, unless items are strings.
+func parseSlice(values []string, rtype reflect.Type, source string, key string) reflect.Value {
+	if values == nil {
+		return reflect.Zero(rtype)
+	}
+	slice := reflect.MakeSlice(rtype, 0, len(values))
+	for _, value := range values {
+		if value == "" && baseKind(rtype.Elem()) != reflect.String {
+			continue
+		}
+		slice = reflect.Append(slice, parseInput(value, true, rtype.Elem(), source, key))
+	}
+	return slice
+}
+
+// multiInput binds every value given for a header, query or form key to a slice
+type multiInput struct {
+	source  string
+	key     string
+	rtype   reflect.Type
+	options inputOptions
+}
+
+func (input multiInput) read(request *lazyRequest) reflect.Value {
+	var values []string
+	switch input.source {
+	case "header":
+		values = request.httpRequest.Header.Values(input.key)
+	case "query":
+		values = request.getQueryValues(input.key)
+	case "form":
+		values = request.getForm().Value[input.key]
+	}
+	values = input.options.values(values, input.source, input.key)
+	return parseSlice(values, input.rtype, input.source, input.key)
+}
+
+// deepObjectInput binds query keys such as filter[name]=x to a map or struct.
+// Struct fields are named like on json, and both maps and structs can hold slices.
+type deepObjectInput struct {
+	key     string
+	rtype   reflect.Type
+	fields  map[string]reflect.StructField
+	options inputOptions
+}
+
+func newDeepObjectInput(key string, rtype reflect.Type, options inputOptions) deepObjectInput {
+	expected := "map[string]T or struct, with " + parseableTypes + " values, or slices of them"
+	input := deepObjectInput{key: key, rtype: rtype, options: options}
+	switch rtype.Kind() {
+	case reflect.Map:
+		if rtype.Key().Kind() != reflect.String || !(canParseString(rtype.Elem()) || isParseableSlice(rtype.Elem())) {
+			panic(unsupportedInput(expected))
+		}
+	case reflect.Struct:
+		input.fields = map[string]reflect.StructField{}
+		for i := 0; i < rtype.NumField(); i++ {
+			field := rtype.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if field.PkgPath != "" || name == "-" {
+				continue
+			}
+			if !canParseString(field.Type) && !isParseableSlice(field.Type) {
+				panic(unsupportedInput(expected))
+			}
+			if name == "" {
+				name = field.Name
+			}
+			input.fields[name] = field
+		}
+	default:
+		panic(unsupportedInput(expected))
+	}
+	return input
+}
+
+func (input deepObjectInput) read(request *lazyRequest) reflect.Value {
+	prefix := input.key + "["
+	found := false
+	var value reflect.Value
+	if input.fields == nil {
+		value = reflect.MakeMap(input.rtype)
+	} else {
+		value = reflect.New(input.rtype).Elem()
+	}
+	for name, values := range request.getQueryAll() {
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, "]") || len(values) == 0 {
+			continue
+		}
+		inner := name[len(prefix) : len(name)-1]
+		if input.fields == nil {
+			found = true
+			item := parseDeepValue(values, input.rtype.Elem(), name)
+			value.SetMapIndex(reflect.ValueOf(inner).Convert(input.rtype.Key()), item)
+		} else if field, ok := input.fields[inner]; ok {
+			found = true
+			value.FieldByIndex(field.Index).Set(parseDeepValue(values, field.Type, name))
+		}
+	}
+	if !found && input.options.required {
+		panic(missingInput("query", input.key))
+	}
+	if !found && input.fields == nil {
+		return reflect.Zero(input.rtype)
+	}
+	return value
+}
+
+func parseDeepValue(values []string, rtype reflect.Type, key string) reflect.Value {
+	if isParseableSlice(rtype) {
+		return parseSlice(values, rtype, "query", key)
+	}
+	return parseInput(values[0], true, rtype, "query", key)
+}
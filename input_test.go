@@ -1,13 +1,41 @@
 package gap
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"path"
 	"strings"
 	"testing"
+	"time"
 )
 
+// multipartBody encodes fields and files, given as pairs of filename and content
+func multipartBody(fields map[string]string, files map[string][]string) (io.Reader, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	for key, pairs := range files {
+		for i := 0; i < len(pairs); i += 2 {
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, key, pairs[i]))
+			header.Set("Content-Type", mime.TypeByExtension(path.Ext(pairs[i])))
+			part, _ := writer.CreatePart(header)
+			part.Write([]byte(pairs[i+1]))
+		}
+	}
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
 func TestInput(t *testing.T) {
 
 	t.Run("can get input from headers", func(t *testing.T) {
@@ -22,7 +50,7 @@ func TestInput(t *testing.T) {
 			}
 			return tOut{}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		request.Header.Set("Authorization", "token")
 		request.Header.Set("Content-Type", "application/json")
@@ -39,12 +67,29 @@ func TestInput(t *testing.T) {
 				t.Errorf("failed to fetch path as input: %s", input.Path)
 			}
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello/world?q=query", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
 	})
 
+	t.Run("can get input from path params", func(t *testing.T) {
+		type tIn struct {
+			UserID string `request:"param,id"`
+			PostID string `request:"param,postID"`
+		}
+		fn := func(input tIn) {
+			if input.UserID != "42" || input.PostID != "7" {
+				t.Errorf("failed to fetch path params: %s, %s", input.UserID, input.PostID)
+			}
+		}
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("GET", "/users/42/posts/7", nil)
+		request = withRoute(request, "/users/{id}/posts/{postID}", map[string]string{"id": "42", "postID": "7"})
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+	})
+
 	t.Run("can get input from query string", func(t *testing.T) {
 		type tIn struct {
 			Limit string `request:"query,limit"`
@@ -57,12 +102,110 @@ func TestInput(t *testing.T) {
 			}
 			return tOut{}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello?limit=10&page=2", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
 	})
 
+	t.Run("converts query, header and param inputs to field types", func(t *testing.T) {
+		type tIn struct {
+			Page    int           `request:"query,page"`
+			Ratio   float64       `request:"query,ratio"`
+			Active  bool          `request:"query,active"`
+			Since   time.Time     `request:"query,since"`
+			Limit   *uint         `request:"query,limit"`
+			Missing *int          `request:"query,missing"`
+			Timeout time.Duration `request:"header,x-timeout"`
+			ID      int64         `request:"param,id"`
+		}
+		called := false
+		fn := func(input tIn) {
+			called = true
+			if input.Page != 2 || input.Ratio != 0.5 || !input.Active || input.Since.Year() != 2021 ||
+				input.Limit == nil || *input.Limit != 10 || input.Missing != nil ||
+				input.Timeout != 5*time.Second || input.ID != 42 {
+				t.Errorf("failed to convert inputs: %+v", input)
+			}
+		}
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("GET", "/hello?page=2&ratio=0.5&active=true&since=2021-01-01T00:00:00Z&limit=10", nil)
+		request.Header.Set("x-timeout", "5s")
+		request = withRoute(request, "/hello/{id}", map[string]string{"id": "42"})
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if !called {
+			t.Errorf("endpoint was not called: %s", response.Body.String())
+		}
+	})
+
+	t.Run("invalid typed input is answered with bad request", func(t *testing.T) {
+		type tIn struct {
+			Page int `request:"query,page"`
+		}
+		ep := newEndpoint(func(input tIn) { t.Error("endpoint should not be called") }, New())
+		request := httptest.NewRequest("GET", "/hello?page=two", nil)
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Code != 400 {
+			t.Errorf("unexpected status code: %d", response.Code)
+		}
+		if response.Body.String() != `{"error":"invalid value for query \"page\": expected integer",`+
+			`"problems":[{"source":"query","key":"page","reason":"expected integer"}]}` {
+			t.Errorf("unexpected body: %s", response.Body.String())
+		}
+	})
+
+	t.Run("string inputs cannot bind to unsupported types", func(t *testing.T) {
+		type tIn struct {
+			Filter struct{} `request:"header,filter"`
+		}
+		type tQuery struct {
+			Filter map[string]struct{} `request:"query,filter"`
+		}
+		func() {
+			defer assertTagPanics(t, "unsupported type on input field")
+			newEndpoint(func(input tIn) {}, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "unsupported type on input field")
+			newEndpoint(func(input tQuery) {}, New())
+		}()
+	})
+
+	t.Run("invalid input is answered with all validation errors", func(t *testing.T) {
+		type tIn struct {
+			Title string `request:"json,title" validate:"required,max=10"`
+			Page  int    `request:"query,page" validate:"min=1"`
+		}
+		ep := newEndpoint(func(input tIn) { t.Error("endpoint should not be called") }, New())
+		request := httptest.NewRequest("GET", "/hello?page=0", strings.NewReader(`{}`))
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Code != 400 {
+			t.Errorf("unexpected status code: %d", response.Code)
+		}
+		if response.Body.String() != `{"error":"title is required; page must be at least 1","problems":[`+
+			`{"source":"json","key":"title","reason":"is required"},`+
+			`{"source":"query","key":"page","reason":"must be at least 1"}]}` {
+			t.Errorf("unexpected body: %s", response.Body.String())
+		}
+	})
+
+	t.Run("valid input reaches the endpoint", func(t *testing.T) {
+		type tIn struct {
+			Title string `request:"json,title" validate:"required,max=10"`
+		}
+		called := false
+		ep := newEndpoint(func(input tIn) { called = true }, New())
+		request := httptest.NewRequest("GET", "/hello", strings.NewReader(`{"title": "lorem"}`))
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if !called {
+			t.Errorf("endpoint was not called: %s", response.Body.String())
+		}
+	})
+
 	t.Run("can get input from json body", func(t *testing.T) {
 		type tIn struct {
 			Title  string `request:"json,title"`
@@ -75,12 +218,225 @@ func TestInput(t *testing.T) {
 			}
 			return tOut{}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", strings.NewReader(`{"title": "lorem ipsum", "public": true}`))
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
 	})
 
+	t.Run("decodes json values into field types", func(t *testing.T) {
+		type address struct {
+			Street string `json:"street"`
+			Zip    int    `json:"zip"`
+		}
+		type tIn struct {
+			ID      int            `request:"json,id"`
+			Address address        `request:"json,address"`
+			Tags    []string       `request:"json,tags"`
+			Scores  map[string]int `request:"json,scores"`
+			Parent  *address       `request:"json,parent"`
+		}
+		called := false
+		fn := func(input tIn) {
+			called = true
+			if input.ID != 1 || input.Address.Street != "main st" || input.Address.Zip != 123 ||
+				len(input.Tags) != 2 || input.Tags[1] != "b" || input.Scores["x"] != 10 || input.Parent != nil {
+				t.Errorf("failed to decode json: %+v", input)
+			}
+		}
+		ep := newEndpoint(fn, New())
+		body := `{"id": 1, "address": {"street": "main st", "zip": 123}, "tags": ["a", "b"], "scores": {"x": 10}}`
+		request := httptest.NewRequest("POST", "/hello", strings.NewReader(body))
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if !called {
+			t.Errorf("endpoint was not called: %s", response.Body.String())
+		}
+	})
+
+	t.Run("can decode whole json body into a field", func(t *testing.T) {
+		type payload struct {
+			Title string   `json:"title"`
+			Tags  []string `json:"tags"`
+		}
+		type tIn struct {
+			Payload payload `request:"json"`
+			Title   string  `request:"json,title"`
+		}
+		called := false
+		fn := func(input tIn) {
+			called = true
+			if input.Payload.Title != "lorem" || len(input.Payload.Tags) != 1 || input.Title != "lorem" {
+				t.Errorf("failed to decode json body: %+v", input)
+			}
+		}
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("POST", "/hello", strings.NewReader(`{"title": "lorem", "tags": ["a"]}`))
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if !called {
+			t.Errorf("endpoint was not called: %s", response.Body.String())
+		}
+	})
+
+	t.Run("json values of wrong types are answered with bad request", func(t *testing.T) {
+		type address struct {
+			Zip int `json:"zip"`
+		}
+		type tIn struct {
+			ID      int     `request:"json,id"`
+			Address address `request:"json,address"`
+		}
+		type testCase struct {
+			body    string
+			message string
+		}
+		cases := []testCase{
+			testCase{`{"id": "one"}`, `{"error":"invalid value for json \"id\": expected int","problems":[{"source":"json","key":"id","reason":"expected int"}]}`},
+			testCase{`{"id": 1.5}`, `{"error":"invalid value for json \"id\": expected int","problems":[{"source":"json","key":"id","reason":"expected int"}]}`},
+			testCase{`{"address": {"zip": "x"}}`, `{"error":"invalid value for json \"address.zip\": expected int","problems":[{"source":"json","key":"address.zip","reason":"expected int"}]}`},
+			testCase{`[1, 2]`, `{"error":"invalid json","problems":[{"source":"json","key":"","reason":"expected object"}]}`},
+		}
+		for _, tcase := range cases {
+			t.Run(tcase.body, func(t *testing.T) {
+				ep := newEndpoint(func(input tIn) { t.Error("endpoint should not be called") }, New())
+				request := httptest.NewRequest("POST", "/hello", strings.NewReader(tcase.body))
+				response := httptest.NewRecorder()
+				ep.handle(request, response)
+				if response.Code != 400 || response.Body.String() != tcase.message {
+					t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("can get input from urlencoded form", func(t *testing.T) {
+		type tIn struct {
+			Name string `request:"form,name"`
+			Age  int    `request:"form,age"`
+		}
+		called := false
+		fn := func(input tIn) {
+			called = true
+			if input.Name != "john" || input.Age != 30 {
+				t.Errorf("failed to fetch form input: %+v", input)
+			}
+		}
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("POST", "/hello", strings.NewReader("name=john&age=30"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if !called {
+			t.Errorf("endpoint was not called: %s", response.Body.String())
+		}
+	})
+
+	t.Run("can get input and files from multipart form", func(t *testing.T) {
+		type tIn struct {
+			Name        string `request:"form,name"`
+			Avatar      File   `request:"file,avatar"`
+			Attachments []File `request:"file,attachments"`
+			Missing     *File  `request:"file,missing"`
+		}
+		called := false
+		fn := func(input tIn) {
+			called = true
+			if input.Name != "john" || input.Missing != nil || len(input.Attachments) != 2 {
+				t.Errorf("failed to fetch multipart input: %+v", input)
+			}
+			if input.Avatar.Filename != "avatar.png" || input.Avatar.Size != 5 || input.Avatar.ContentType != "image/png" {
+				t.Errorf("failed to fetch file metadata: %+v", input.Avatar)
+			}
+			file, err := input.Avatar.Open()
+			if err != nil {
+				t.Fatalf("failed to open file: %s", err)
+			}
+			defer file.Close()
+			content, _ := ioutil.ReadAll(file)
+			if string(content) != "image" {
+				t.Errorf("failed to read file: %s", content)
+			}
+		}
+		body, contentType := multipartBody(map[string]string{"name": "john"}, map[string][]string{
+			"avatar":      []string{"avatar.png", "image"},
+			"attachments": []string{"a.txt", "first", "b.txt", "second"},
+		})
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("POST", "/hello", body)
+		request.Header.Set("Content-Type", contentType)
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if !called {
+			t.Errorf("endpoint was not called: %s", response.Body.String())
+		}
+	})
+
+	t.Run("form bodies over the upload limit are answered with request too large", func(t *testing.T) {
+		type tIn struct {
+			Avatar File `request:"file,avatar"`
+		}
+		app := New()
+		app.UploadLimits(10, 100)
+		ep := newEndpoint(func(input tIn) { t.Error("endpoint should not be called") }, app)
+		body, contentType := multipartBody(nil, map[string][]string{"avatar": []string{"avatar.png", strings.Repeat("x", 200)}})
+		request := httptest.NewRequest("POST", "/hello", body)
+		request.Header.Set("Content-Type", contentType)
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Code != 413 || response.Body.String() != `{"error":"request body too large"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("files can only bind to file types", func(t *testing.T) {
+		type tIn struct {
+			Avatar io.Reader `request:"file,avatar"`
+		}
+		defer assertTagPanics(t, "unsupported type on input field")
+		newEndpoint(func(input tIn) {}, New())
+	})
+
+	t.Run("can get input from cookies", func(t *testing.T) {
+		type tIn struct {
+			Session string       `request:"cookie,session"`
+			Visits  int          `request:"cookie,visits"`
+			Theme   *http.Cookie `request:"cookie,theme"`
+			Missing *http.Cookie `request:"cookie,missing"`
+			Cookie  http.Cookie  `request:"cookie,session"`
+		}
+		fn := func(input tIn) {
+			if input.Session != "abc" || input.Visits != 3 || input.Theme == nil || input.Theme.Value != "dark" {
+				t.Errorf("failed to fetch input cookies: %+v", input)
+			}
+			if input.Missing != nil || input.Cookie.Name != "session" || input.Cookie.Value != "abc" {
+				t.Errorf("unexpected cookie structs: %+v", input)
+			}
+		}
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		request.AddCookie(&http.Cookie{Name: "visits", Value: "3"})
+		request.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+	})
+
+	t.Run("invalid cookie values are answered with bad request", func(t *testing.T) {
+		type tIn struct {
+			Visits int `request:"cookie,visits"`
+		}
+		ep := newEndpoint(func(input tIn) {}, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request.AddCookie(&http.Cookie{Name: "visits", Value: "many"})
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Code != 400 || response.Body.String() != `{"error":"invalid value for cookie \"visits\": expected integer",`+
+			`"problems":[{"source":"cookie","key":"visits","reason":"expected integer"}]}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
 	t.Run("can get input from multiple sources with the same name", func(t *testing.T) {
 		type tIn struct {
 			HeaderAuth string `request:"header,auth"`
@@ -94,7 +450,7 @@ func TestInput(t *testing.T) {
 			}
 			return tOut{}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello?auth=qauth", strings.NewReader(`{"auth": "jauth"}`))
 		request.Header.Set("auth", "hauth")
 		response := httptest.NewRecorder()
@@ -113,7 +469,7 @@ func TestInput(t *testing.T) {
 			}
 			return tOut{}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello?auth=qauth", strings.NewReader("lorem ipsum"))
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -130,10 +486,253 @@ func TestInput(t *testing.T) {
 			}
 			return tOut{}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("POST", "/post", nil)
 		request.Header.Set("content-type", "application/json")
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
 	})
+
+	t.Run("embedded structs are flattened", func(t *testing.T) {
+		type tPagination struct {
+			Page  int `request:"query,page"`
+			Limit int `request:"query,limit" validate:"max=100"`
+		}
+		type tAuth struct {
+			Token string `request:"header,authorization"`
+		}
+		type tIn struct {
+			tPagination
+			tAuth
+			Name string `request:"query,name"`
+		}
+		var input tIn
+		ep := newEndpoint(func(in tIn) { input = in }, New())
+		request := httptest.NewRequest("GET", "/hello?page=2&limit=10&name=ana", nil)
+		request.Header.Set("Authorization", "token")
+		ep.handle(request, httptest.NewRecorder())
+		if input.Page != 2 || input.Limit != 10 || input.Token != "token" || input.Name != "ana" {
+			t.Errorf("failed to fetch embedded input: %+v", input)
+		}
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello?limit=200", nil), response)
+		if response.Code != 400 || !strings.HasPrefix(response.Body.String(), `{"error":"limit must be at most 100"`) {
+			t.Errorf("failed to validate embedded input: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("embedded struct pointers are flattened and allocated", func(t *testing.T) {
+		type TPagination struct {
+			Page int `request:"query,page" validate:"min=1"`
+		}
+		type tIn struct {
+			*TPagination
+			Name string `request:"query,name"`
+		}
+		var input tIn
+		ep := newEndpoint(func(in tIn) { input = in }, New())
+		ep.handle(httptest.NewRequest("GET", "/hello?page=2&name=ana", nil), httptest.NewRecorder())
+		if input.TPagination == nil || input.Page != 2 || input.Name != "ana" {
+			t.Errorf("failed to fetch embedded input: %+v", input)
+		}
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello?page=0", nil), response)
+		if response.Code != 400 {
+			t.Errorf("failed to validate embedded input: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("embedded pointers to unexported structs can't be bound", func(t *testing.T) {
+		type tPagination struct {
+			Page int `request:"query,page"`
+		}
+		type tIn struct {
+			*tPagination
+		}
+		defer assertTagPanics(t, "embedded pointer to unexported struct on input field")
+		newEndpoint(func(in tIn) {}, New())
+	})
+
+	t.Run("unexported and untagged fields are skipped", func(t *testing.T) {
+		type tIn struct {
+			Name    string `request:"query,name"`
+			Cache   map[string]string
+			private string `request:"query,private"`
+		}
+		var input tIn
+		ep := newEndpoint(func(in tIn) { input = in }, New())
+		ep.handle(httptest.NewRequest("GET", "/hello?name=ana&private=x", nil), httptest.NewRecorder())
+		if input.Name != "ana" || input.Cache != nil || input.private != "" {
+			t.Errorf("unexpected input: %+v", input)
+		}
+	})
+
+	t.Run("absent inputs take their default", func(t *testing.T) {
+		type tIn struct {
+			Page  int           `request:"query,page,default=1"`
+			Sort  string        `request:"query,sort,default=name"`
+			Limit *int          `request:"header,x-limit,default=20"`
+			Wait  time.Duration `request:"form,wait,default=1s"`
+		}
+		var input tIn
+		ep := newEndpoint(func(in tIn) { input = in }, New())
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), httptest.NewRecorder())
+		if input.Page != 1 || input.Sort != "name" || input.Limit == nil || *input.Limit != 20 || input.Wait != time.Second {
+			t.Errorf("failed to apply defaults: %+v", input)
+		}
+		ep.handle(httptest.NewRequest("GET", "/hello?page=3&sort=", nil), httptest.NewRecorder())
+		if input.Page != 3 || input.Sort != "" {
+			t.Errorf("defaults replaced given values: %+v", input)
+		}
+	})
+
+	t.Run("absent required inputs are answered with bad request", func(t *testing.T) {
+		type tIn struct {
+			Tenant  string       `request:"header,x-tenant,required"`
+			Session *http.Cookie `request:"cookie,session,required"`
+		}
+		called := false
+		ep := newEndpoint(func(in tIn) { called = true }, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		expected := `{"error":"missing header \"x-tenant\"","problems":[{"source":"header","key":"x-tenant","reason":"is required"}]}`
+		if called || response.Code != 400 || response.Body.String() != expected {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request.Header.Set("X-Tenant", "")
+		response = httptest.NewRecorder()
+		ep.handle(request, response)
+		if called || response.Code != 400 || !strings.HasPrefix(response.Body.String(), `{"error":"missing cookie \"session\""`) {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+		request.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		ep.handle(request, httptest.NewRecorder())
+		if !called {
+			t.Error("failed to call endpoint with empty required header")
+		}
+	})
+
+	t.Run("invalid input options are rejected on routing", func(t *testing.T) {
+		func() {
+			defer assertTagPanics(t, "invalid option on input field")
+			newEndpoint(func(in struct {
+				Page int `request:"query,page,optional"`
+			}) {
+			}, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "invalid default on input field: expected integer")
+			newEndpoint(func(in struct {
+				Page int `request:"query,page,default=first"`
+			}) {
+			}, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "invalid default on input field")
+			newEndpoint(func(in struct {
+				Session http.Cookie `request:"cookie,session,default=abc"`
+			}) {
+			}, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "invalid option on input field")
+			newEndpoint(func(in struct {
+				Page int `request:"query,page,comma"`
+			}) {
+			}, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "invalid default on input field")
+			newEndpoint(func(in struct {
+				Filter map[string]string `request:"query,filter,default=x"`
+			}) {
+			}, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "invalid option on input field: required inputs can't have a default")
+			newEndpoint(func(in struct {
+				Page int `request:"query,page,required,default=1"`
+			}) {
+			}, New())
+		}()
+	})
+
+	t.Run("repeated values bind to slices", func(t *testing.T) {
+		type tIn struct {
+			Tags    []string `request:"query,tag"`
+			IDs     []int    `request:"query,ids,comma"`
+			Accept  []string `request:"header,accept,comma"`
+			Forward []string `request:"header,x-forwarded-for"`
+			Colors  []string `request:"form,color"`
+			Sizes   []int    `request:"query,size,default=10"`
+			Missing []int    `request:"query,missing"`
+		}
+		var input tIn
+		ep := newEndpoint(func(in tIn) { input = in }, New())
+		request := httptest.NewRequest("POST", "/hello?tag=a&tag=b&ids=1,2&ids=3,", strings.NewReader("color=red&color=blue"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Accept", "text/html, application/json")
+		request.Header.Add("X-Forwarded-For", "10.0.0.1")
+		request.Header.Add("X-Forwarded-For", "10.0.0.2")
+		ep.handle(request, httptest.NewRecorder())
+		if fmt.Sprint(input.Tags, input.IDs, input.Accept, input.Forward, input.Colors, input.Sizes) !=
+			"[a b] [1 2 3] [text/html application/json] [10.0.0.1 10.0.0.2] [red blue] [10]" {
+			t.Errorf("failed to bind slices: %+v", input)
+		}
+		if input.Missing != nil {
+			t.Errorf("absent slice should be nil: %v", input.Missing)
+		}
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello?ids=1,x", nil), response)
+		if response.Code != 400 || !strings.HasPrefix(response.Body.String(), `{"error":"invalid value for query \"ids\": expected integer"`) {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("deep object queries bind to maps and structs", func(t *testing.T) {
+		type tFilter struct {
+			Name  string   `json:"name"`
+			Age   *int     `json:"age"`
+			Roles []string `json:"roles"`
+			Skip  string   `json:"-"`
+		}
+		type tIn struct {
+			Filter tFilter             `request:"query,filter"`
+			Sort   map[string]string   `request:"query,sort"`
+			Tags   map[string][]string `request:"query,tags"`
+			Empty  map[string]int      `request:"query,empty"`
+		}
+		var input tIn
+		ep := newEndpoint(func(in tIn) { input = in }, New())
+		query := "filter[name]=ana&filter[age]=30&filter[roles]=a&filter[roles]=b&filter[Skip]=x&filter[other]=y" +
+			"&sort[name]=asc&sort[age]=desc&tags[x]=1&tags[x]=2"
+		ep.handle(httptest.NewRequest("GET", "/hello?"+query, nil), httptest.NewRecorder())
+		if input.Filter.Name != "ana" || input.Filter.Age == nil || *input.Filter.Age != 30 ||
+			fmt.Sprint(input.Filter.Roles) != "[a b]" || input.Filter.Skip != "" {
+			t.Errorf("failed to bind struct: %+v", input.Filter)
+		}
+		if fmt.Sprint(input.Sort, input.Tags) != "map[age:desc name:asc] map[x:[1 2]]" || input.Empty != nil {
+			t.Errorf("failed to bind maps: %v %v %v", input.Sort, input.Tags, input.Empty)
+		}
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello?filter[age]=old", nil), response)
+		expected := `{"error":"invalid value for query \"filter[age]\": expected integer",` +
+			`"problems":[{"source":"query","key":"filter[age]","reason":"expected integer"}]}`
+		if response.Code != 400 || response.Body.String() != expected {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("required deep objects need at least one key", func(t *testing.T) {
+		type tIn struct {
+			Filter map[string]string `request:"query,filter,required"`
+		}
+		ep := newEndpoint(func(in tIn) {}, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello?filter=x", nil), response)
+		if response.Code != 400 || !strings.HasPrefix(response.Body.String(), `{"error":"missing query \"filter\""`) {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
 }
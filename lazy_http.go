@@ -1,82 +1,162 @@
 package gap
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 )
 
 type lazyRequest struct {
 	httpRequest *http.Request
 	parsedQuery url.Values
-	parsedJSON  map[string]interface{}
-	body        io.Reader
+	parsedJSON  map[string]json.RawMessage
+	jsonBody    []byte
+	parsedForm  *multipart.Form
+	limits      uploadLimits
 }
 
-type requestError struct {
-	Status  int    `response:"status"`
-	Message string `response:"json,error"`
+func newLazyRequest(httpRequest *http.Request, limits uploadLimits) *lazyRequest {
+	return &lazyRequest{httpRequest: httpRequest, limits: limits}
 }
 
-func (err requestError) Error() string {
-	return err.Message
+func (request *lazyRequest) getQuery(key string) (string, bool) {
+	values := request.getQueryValues(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
 }
 
-func newLazyRequest(httpRequest *http.Request) *lazyRequest {
-	return &lazyRequest{httpRequest: httpRequest}
+func (request *lazyRequest) getQueryValues(key string) []string {
+	return request.getQueryAll()[key]
 }
 
-func (request *lazyRequest) getQuery(key string) string {
+func (request *lazyRequest) getQueryAll() url.Values {
 	if request.parsedQuery == nil {
 		request.parsedQuery = request.httpRequest.URL.Query()
 	}
-	return request.parsedQuery.Get(key)
+	return request.parsedQuery
 }
 
-func (request *lazyRequest) getJSON(key string) interface{} {
+func (request *lazyRequest) getJSON(key string) (json.RawMessage, bool) {
 	if request.parsedJSON == nil {
+		if err := json.Unmarshal(request.getJSONBody(), &request.parsedJSON); err != nil || request.parsedJSON == nil {
+			panic(newBadRequest("invalid json", "json", "", "expected object"))
+		}
+	}
+	value, found := request.parsedJSON[key]
+	return value, found
+}
+
+func (request *lazyRequest) getJSONBody() []byte {
+	if request.jsonBody == nil {
 		body, err := ioutil.ReadAll(request.httpRequest.Body)
 		if err != nil {
 			panic(err)
 		}
-		if err := json.Unmarshal(body, &request.parsedJSON); err != nil {
-			panic(requestError{400, "invalid json"})
+		var raw json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			panic(newBadRequest("invalid json", "json", "", jsonSyntaxReason(err)))
+		}
+		request.jsonBody = body
+	}
+	return request.jsonBody
+}
+
+// jsonSyntaxReason tells where a body stopped being valid json
+func jsonSyntaxReason(err error) string {
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		return fmt.Sprintf("%s at offset %d", syntaxErr, syntaxErr.Offset)
+	}
+	return err.Error()
+}
+
+// getForm parses urlencoded and multipart bodies, along with the files uploaded on the latter
+func (request *lazyRequest) getForm() *multipart.Form {
+	if request.parsedForm != nil {
+		return request.parsedForm
+	}
+	httpRequest := request.httpRequest
+	if request.limits.total > 0 {
+		httpRequest.Body = http.MaxBytesReader(nil, httpRequest.Body, request.limits.total)
+	}
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(httpRequest.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		memory := request.limits.memory
+		if memory <= 0 {
+			memory = DefaultUploadMemory
 		}
+		err = httpRequest.ParseMultipartForm(memory)
+	} else {
+		err = httpRequest.ParseForm()
 	}
-	return request.parsedJSON[key]
+	if err != nil && strings.Contains(err.Error(), "request body too large") {
+		panic(RequestError{Status: 413, Message: "request body too large"})
+	}
+	if err != nil {
+		panic(newBadRequest("invalid form", "form", "", err.Error()))
+	}
+	request.parsedForm = &multipart.Form{Value: httpRequest.PostForm}
+	if httpRequest.MultipartForm != nil {
+		request.parsedForm.File = httpRequest.MultipartForm.File
+	}
+	return request.parsedForm
 }
 
+// bufferPool holds buffers for encoding response fields, reused across requests
+var bufferPool = sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+
 type lazyResponse struct {
 	httpResponse http.ResponseWriter
-	jsonMap      map[string]interface{}
+	encoder      encoder
+	fields       map[string]interface{}
 	status       int
 	body         io.Reader
+	stream       *responseStream
+	done         <-chan struct{}
 }
 
-func newLazyResponse(httpResponse http.ResponseWriter) *lazyResponse {
-	return &lazyResponse{httpResponse: httpResponse, status: 200}
+func newLazyResponse(httpResponse http.ResponseWriter, enc encoder) *lazyResponse {
+	return &lazyResponse{httpResponse: httpResponse, encoder: enc, status: 200}
 }
 
-func (response *lazyResponse) setJSON(key string, value interface{}) {
-	if response.jsonMap == nil {
-		response.jsonMap = map[string]interface{}{}
+func (response *lazyResponse) setField(key string, value interface{}) {
+	if response.fields == nil {
+		response.fields = map[string]interface{}{}
 	}
-	response.jsonMap[key] = value
+	response.fields[key] = value
 }
 
 func (response *lazyResponse) send() {
-	response.httpResponse.WriteHeader(response.status)
-	if response.body != nil {
-		io.Copy(response.httpResponse, response.body)
+	if response.stream != nil {
+		response.sendStream()
 		return
 	}
-	if response.jsonMap != nil {
-		body, err := json.Marshal(response.jsonMap)
-		if err != nil {
+	if response.body == nil && response.fields != nil {
+		body := bufferPool.Get().(*bytes.Buffer)
+		body.Reset()
+		defer bufferPool.Put(body)
+		if err := response.encoder.codec.Encode(body, response.fields); err != nil {
 			panic(err)
 		}
-		response.httpResponse.Write(body)
+		if response.httpResponse.Header().Get("Content-Type") == "" {
+			response.httpResponse.Header().Set("Content-Type", response.encoder.mime)
+		}
+		response.httpResponse.WriteHeader(response.status)
+		response.httpResponse.Write(body.Bytes())
+		return
+	}
+	response.httpResponse.WriteHeader(response.status)
+	if response.body != nil {
+		io.Copy(response.httpResponse, response.body)
 	}
 }
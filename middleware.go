@@ -0,0 +1,45 @@
+package gap
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Middleware wraps a handler with additional behavior (e.g. logging, auth, CORS).
+// It's the same signature commonly used by net/http compatible libraries.
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps handler so the first middleware is the outermost one
+func chain(middleware []Middleware, handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// handlerCache holds a middleware chain, so middleware is only constructed once rather than on every request.
+// The chain is rebuilt when the version changes, which happens whenever middleware is added to the app or a group.
+type handlerCache struct {
+	mutex  sync.Mutex
+	cached atomic.Value
+}
+
+type cachedHandler struct {
+	version int32
+	handler http.Handler
+}
+
+func (cache *handlerCache) get(version int32, build func() http.Handler) http.Handler {
+	if cached, ok := cache.cached.Load().(cachedHandler); ok && cached.version == version {
+		return cached.handler
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cached, ok := cache.cached.Load().(cachedHandler); ok && cached.version == version {
+		return cached.handler
+	}
+	handler := build()
+	cache.cached.Store(cachedHandler{version, handler})
+	return handler
+}
@@ -0,0 +1,129 @@
+package gap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	trace := func(name string, calls *[]string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				*calls = append(*calls, name)
+				next.ServeHTTP(response, request)
+			})
+		}
+	}
+
+	t.Run("chain runs middleware in the order given", func(t *testing.T) {
+		calls := []string{}
+		handler := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			calls = append(calls, "handler")
+		})
+		chain([]Middleware{trace("first", &calls), trace("second", &calls)}, handler).ServeHTTP(nil, nil)
+		if strings.Join(calls, ",") != "first,second,handler" {
+			t.Errorf("unexpected call order: %v", calls)
+		}
+	})
+
+	t.Run("app middleware wraps route middleware", func(t *testing.T) {
+		calls := []string{}
+		app := New()
+		app.Use(trace("app", &calls))
+		app.Route("GET", "/hello", func() { calls = append(calls, "endpoint") }, trace("route", &calls))
+		app.Route("GET", "/world", func() { calls = append(calls, "other") })
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/world", nil))
+		if strings.Join(calls, ",") != "app,route,endpoint,app,other" {
+			t.Errorf("unexpected call order: %v", calls)
+		}
+	})
+
+	t.Run("app middleware also wraps requests without a route", func(t *testing.T) {
+		calls := []string{}
+		app := New()
+		app.Use(trace("app", &calls))
+		app.Route("GET", "/hello", func() {})
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/missing", nil))
+		app.ServeHTTP(response, httptest.NewRequest("POST", "/hello", nil))
+		if len(calls) != 2 {
+			t.Errorf("unexpected calls: %v", calls)
+		}
+	})
+
+	t.Run("middleware can stop the request", func(t *testing.T) {
+		deny := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				response.WriteHeader(401)
+			})
+		}
+		app := New()
+		app.Route("GET", "/hello", func() { t.Error("endpoint should not be called") }, deny)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/hello", nil))
+		if response.Code != 401 {
+			t.Errorf("unexpected status code: %d", response.Code)
+		}
+	})
+
+	t.Run("middleware has access to route information", func(t *testing.T) {
+		path, id := "", ""
+		app := New()
+		app.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				path, id = RoutePath(request), Param(request, "id")
+				next.ServeHTTP(response, request)
+			})
+		})
+		app.Route("GET", "/users/{id}", func() {})
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+		if path != "/users/{id}" || id != "42" {
+			t.Errorf("unexpected route information: %s %s", path, id)
+		}
+	})
+
+	t.Run("middleware is constructed once, until more is added", func(t *testing.T) {
+		built := 0
+		counted := func(next http.Handler) http.Handler {
+			built++
+			return next
+		}
+		app := New()
+		app.Use(counted)
+		group := app.Group("/api", counted)
+		group.Route("GET", "/users", func() {}, counted)
+		for i := 0; i < 3; i++ {
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/users", nil))
+		}
+		if built != 5 {
+			t.Errorf("unexpected constructor calls: %d", built)
+		}
+		var calls []string
+		group.Use(trace("group", &calls))
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+		if built != 8 || strings.Join(calls, ",") != "group,group" {
+			t.Errorf("unexpected constructor calls after adding middleware: %d %v", built, calls)
+		}
+	})
+
+	t.Run("method not allowed chains answer the methods of each path", func(t *testing.T) {
+		app := New()
+		app.Use(func(next http.Handler) http.Handler { return next })
+		app.Route("GET", "/a", func() {})
+		app.Route("PUT", "/b", func() {})
+		for path, allow := range map[string]string{"/a": "GET", "/b": "PUT"} {
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, httptest.NewRequest("POST", path, nil))
+			if response.Code != 405 || response.Header().Get("Allow") != allow {
+				t.Errorf("unexpected response: %d %v", response.Code, response.Header())
+			}
+		}
+	})
+}
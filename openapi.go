@@ -0,0 +1,544 @@
+package gap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	textMarshalerType     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	openAPIStringSchema   = map[string]interface{}{"type": "string"}
+	openAPIProblemsSchema = map[string]interface{}{"type": "array", "items": map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"source": openAPIStringSchema, "key": openAPIStringSchema, "reason": openAPIStringSchema},
+	}}
+	openAPIErrorSchema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+		"error":    openAPIStringSchema,
+		"problems": openAPIProblemsSchema,
+	}}
+	openAPIProblemSchema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+		"type":     openAPIStringSchema,
+		"title":    openAPIStringSchema,
+		"status":   map[string]interface{}{"type": "integer"},
+		"detail":   openAPIStringSchema,
+		"problems": openAPIProblemsSchema,
+	}}
+	openAPIBinarySchema = map[string]interface{}{"type": "string", "format": "binary"}
+)
+
+// OpenAPIInfo sets the title and version of the API on the OpenAPI document
+func (app *App) OpenAPIInfo(title string, version string) {
+	app.apiTitle = title
+	app.apiVersion = version
+}
+
+// OpenAPI builds an OpenAPI 3 document describing every route in the app.
+// Inputs, outputs and declared errors are described from the endpoint structs and their tags.
+func (app *App) OpenAPI() map[string]interface{} {
+	schemas := newOpenAPISchemas()
+	mimes := []string{}
+	for _, enc := range app.encoders {
+		mimes = append(mimes, enc.mime)
+	}
+	paths := map[string]interface{}{}
+	for _, rp := range app.paths {
+		operations := map[string]interface{}{}
+		for method, rt := range rp.routes {
+			if !rt.hidden {
+				operations[strings.ToLower(method)] = rt.operation(rp.segments, schemas, mimes)
+			}
+		}
+		if len(operations) > 0 {
+			paths[rp.path] = operations
+		}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": app.apiTitle, "version": app.apiVersion},
+		"paths":   paths,
+	}
+	if len(schemas.schemas) > 0 {
+		doc["components"] = map[string]interface{}{"schemas": schemas.schemas}
+	}
+	return doc
+}
+
+// ServeOpenAPI routes GET requests on path to the OpenAPI document of the app (e.g. /openapi.json).
+// The route itself is left out of the document.
+func (app *App) ServeOpenAPI(path string) *Route {
+	type openAPIOutput struct {
+		ContentType string    `response:"header,Content-Type"`
+		Body        io.Reader `response:"body"`
+	}
+	rt := app.Route("GET", path, func() (openAPIOutput, error) {
+		body, err := json.Marshal(app.OpenAPI())
+		return openAPIOutput{"application/json", bytes.NewReader(body)}, err
+	})
+	rt.hidden = true
+	return rt
+}
+
+func (rt *Route) operation(segments []segment, schemas *openAPISchemas, mimes []string) map[string]interface{} {
+	op := map[string]interface{}{}
+	if rt.summary != "" {
+		op["summary"] = rt.summary
+	}
+	ep := rt.endpoint
+	if parameters := inputParameters(segments, ep.inType, schemas); len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	if ep.inType != nil {
+		if body := inputBody(ep.inType, schemas); body != nil {
+			op["requestBody"] = body
+		}
+	}
+	success, _ := outputResponse(ep.outType(), "OK", schemas, mimes)
+	responses := map[string]interface{}{"200": success}
+	errResponses := map[string][]map[string]interface{}{}
+	plainError := map[string]interface{}{"schema": openAPIErrorSchema}
+	if ep.app.problemDetails {
+		plainError = map[string]interface{}{"problem": true}
+	}
+	if ep.inType != nil || ep.returnsError() {
+		errResponses["400"] = append(errResponses["400"], plainError)
+	}
+	if ep.timeout > 0 {
+		errResponses["503"] = append(errResponses["503"], plainError)
+	}
+	for _, err := range rt.errors {
+		status, response := errorResponse(err, schemas, plainError)
+		errResponses[status] = append(errResponses[status], response)
+	}
+	for status, candidates := range errResponses {
+		responses[status] = mergeResponses(status, candidates, mimes)
+	}
+	if ep.encodes {
+		// not acceptable responses can't be negotiated, so they are always json
+		responses["406"] = mergeResponses("406", []map[string]interface{}{plainError}, []string{"application/json"})
+	}
+	op["responses"] = responses
+	return op
+}
+
+func (ep *endpoint) outType() reflect.Type {
+	if ep.rtype.NumOut() > 0 {
+		return structElem(ep.rtype.Out(0))
+	}
+	return nil
+}
+
+func (ep *endpoint) returnsError() bool {
+	return ep.rtype.NumOut() > 0 && typeIsError(ep.rtype.Out(ep.rtype.NumOut()-1))
+}
+
+// inputParameters describes every param of the route path, refined by the input fields binding them,
+// along with query, header and cookie inputs
+func inputParameters(segments []segment, inType reflect.Type, schemas *openAPISchemas) []interface{} {
+	locations := map[string]string{"param": "path", "query": "query", "header": "header", "cookie": "cookie"}
+	parameters := []interface{}{}
+	pathParams := map[string]map[string]interface{}{}
+	for _, seg := range segments {
+		if seg.param {
+			parameter := map[string]interface{}{"name": seg.value, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}}
+			pathParams[seg.value] = parameter
+			parameters = append(parameters, parameter)
+		}
+	}
+	if inType == nil {
+		return parameters
+	}
+	for _, field := range taggedFields(inType, "request") {
+		tagParts := splitTag(field.Tag.Get("request"))
+		location, found := locations[tagParts[0]]
+		if !found || len(tagParts) < 2 {
+			continue
+		}
+		schema := schemas.stringSchema(field.Type)
+		applyValidation(schema, field)
+		applyDefault(schema, tagParts)
+		if location == "path" {
+			if parameter, found := pathParams[tagParts[1]]; found {
+				parameter["schema"] = schema
+			}
+			continue
+		}
+		parameter := map[string]interface{}{"name": tagParts[1], "in": location, "schema": schema}
+		if isRequired(field) {
+			parameter["required"] = true
+		}
+		if location == "query" && !canParseString(field.Type) && !isParseableSlice(field.Type) {
+			parameter["style"], parameter["explode"] = "deepObject", true
+		} else if hasOption(tagParts, "comma") {
+			parameter["explode"] = false
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
+
+func inputBody(inType reflect.Type, schemas *openAPISchemas) map[string]interface{} {
+	properties := map[string]interface{}{}
+	formProperties := map[string]interface{}{}
+	required := []string{}
+	var schema map[string]interface{}
+	mime, formMime := "application/json", "application/x-www-form-urlencoded"
+	for _, field := range taggedFields(inType, "request") {
+		tagParts := splitTag(field.Tag.Get("request"))
+		switch {
+		case tagParts[0] == "json" && len(tagParts) == 1:
+			schema = schemas.schemaOf(field.Type)
+		case tagParts[0] == "json":
+			property := schemas.schemaOf(field.Type)
+			applyValidation(property, field)
+			properties[tagParts[1]] = property
+			if isRequired(field) {
+				required = append(required, tagParts[1])
+			}
+		case tagParts[0] == "form":
+			property := schemas.stringSchema(field.Type)
+			applyValidation(property, field)
+			applyDefault(property, tagParts)
+			formProperties[tagParts[1]] = property
+		case tagParts[0] == "file" && field.Type == fileSliceType:
+			formProperties[tagParts[1]] = map[string]interface{}{"type": "array", "items": openAPIBinarySchema}
+			formMime = "multipart/form-data"
+		case tagParts[0] == "file":
+			formProperties[tagParts[1]] = openAPIBinarySchema
+			formMime = "multipart/form-data"
+		case tagParts[0] == "body":
+			schema, mime = openAPIBinarySchema, "application/octet-stream"
+		}
+	}
+	if len(formProperties) > 0 {
+		schema = map[string]interface{}{"type": "object", "properties": formProperties}
+		mime = formMime
+	}
+	if schema == nil && len(properties) == 0 {
+		return nil
+	}
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+	return map[string]interface{}{
+		"required": true,
+		"content":  map[string]interface{}{mime: map[string]interface{}{"schema": schema}},
+	}
+}
+
+// outputResponse describes an output struct as a response, also returning the schema of its encoded fields
+func outputResponse(outType reflect.Type, description string, schemas *openAPISchemas, mimes []string) (map[string]interface{}, interface{}) {
+	response := map[string]interface{}{"description": description}
+	if outType == nil {
+		return response, nil
+	}
+	properties := map[string]interface{}{}
+	headers := map[string]interface{}{}
+	var body map[string]interface{}
+	for _, field := range taggedFields(outType, "response") {
+		tagParts := splitTag(field.Tag.Get("response"))
+		switch {
+		case (tagParts[0] == "json" || tagParts[0] == "field") && len(tagParts) == 2:
+			properties[tagParts[1]] = schemas.schemaOf(field.Type)
+		case tagParts[0] == "header" && len(tagParts) == 2:
+			headers[tagParts[1]] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		case tagParts[0] == "cookie" && len(tagParts) >= 2:
+			headers["Set-Cookie"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		case tagParts[0] == "body":
+			body = map[string]interface{}{"application/octet-stream": map[string]interface{}{"schema": openAPIBinarySchema}}
+		case tagParts[0] == "stream" && len(tagParts) == 2:
+			body = streamContent(field.Type, tagParts[1], schemas)
+		}
+	}
+	var schema interface{}
+	if len(properties) > 0 {
+		schema = map[string]interface{}{"type": "object", "properties": properties}
+		response["content"] = mediaContent(schema, mimes)
+	}
+	if body != nil {
+		response["content"] = body
+	}
+	if len(headers) > 0 {
+		response["headers"] = headers
+	}
+	return response, schema
+}
+
+func streamContent(rtype reflect.Type, format string, schemas *openAPISchemas) map[string]interface{} {
+	switch format {
+	case "sse":
+		return map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	case "ndjson":
+		itemType, _ := streamItemType(rtype)
+		return map[string]interface{}{"application/x-ndjson": map[string]interface{}{"schema": schemas.schemaOf(itemType)}}
+	}
+	return map[string]interface{}{"application/octet-stream": map[string]interface{}{"schema": openAPIBinarySchema}}
+}
+
+// errorResponse describes a declared error. Errors other than output structs are described as plainError.
+func errorResponse(err error, schemas *openAPISchemas, plainError map[string]interface{}) (string, map[string]interface{}) {
+	rvErr := errorStruct(reflect.ValueOf(err))
+	if !isOutputStruct(rvErr) {
+		return "400", plainError
+	}
+	status := 400
+	for _, field := range taggedFields(rvErr.Type(), "response") {
+		if splitTag(field.Tag.Get("response"))[0] != "status" {
+			continue
+		}
+		if value, ok := lookupField(rvErr, field.Index); ok {
+			status = int(value.Int())
+		}
+	}
+	response, schema := outputResponse(rvErr.Type(), "", schemas, nil)
+	response["schema"] = schema
+	return strconv.Itoa(status), response
+}
+
+// mergeResponses describes every candidate response of a status at once.
+// Candidates marked as problems are described as application/problem+json, regardless of encoders.
+func mergeResponses(status string, candidates []map[string]interface{}, mimes []string) map[string]interface{} {
+	statusCode, _ := strconv.Atoi(status)
+	schemas := []interface{}{}
+	seen := map[string]bool{}
+	var headers interface{}
+	problem := false
+	for _, candidate := range candidates {
+		if candidate["headers"] != nil {
+			headers = candidate["headers"]
+		}
+		if candidate["problem"] == true {
+			problem = true
+			continue
+		}
+		if candidate["schema"] == nil {
+			continue
+		}
+		key, _ := json.Marshal(candidate["schema"])
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			schemas = append(schemas, candidate["schema"])
+		}
+	}
+	response := map[string]interface{}{"description": http.StatusText(statusCode)}
+	if len(schemas) == 1 {
+		response["content"] = mediaContent(schemas[0], mimes)
+	} else if len(schemas) > 1 {
+		response["content"] = mediaContent(map[string]interface{}{"oneOf": schemas}, mimes)
+	}
+	if problem {
+		if response["content"] == nil {
+			response["content"] = map[string]interface{}{}
+		}
+		response["content"].(map[string]interface{})["application/problem+json"] = map[string]interface{}{"schema": openAPIProblemSchema}
+	}
+	if headers != nil {
+		response["headers"] = headers
+	}
+	return response
+}
+
+func mediaContent(schema interface{}, mimes []string) map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, mime := range mimes {
+		content[mime] = map[string]interface{}{"schema": schema}
+	}
+	return content
+}
+
+// isRequired tells if the field is required by its validate tag, or by a request tag option
+func isRequired(field reflect.StructField) bool {
+	for _, rule := range splitTag(field.Tag.Get("validate")) {
+		if rule == "required" {
+			return true
+		}
+	}
+	return hasOption(splitTag(field.Tag.Get("request")), "required")
+}
+
+// hasOption tells if a request tag has the option after its key
+func hasOption(tagParts []string, option string) bool {
+	for i := 2; i < len(tagParts); i++ {
+		if tagParts[i] == option {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDefault describes the default given on request tag options, as a string unless the schema is numeric or boolean
+func applyDefault(schema map[string]interface{}, tagParts []string) {
+	for i := 2; i < len(tagParts); i++ {
+		if !strings.HasPrefix(tagParts[i], "default=") {
+			continue
+		}
+		raw := strings.TrimPrefix(tagParts[i], "default=")
+		var value interface{} = raw
+		switch schema["type"] {
+		case "integer", "number":
+			value, _ = strconv.ParseFloat(raw, 64)
+		case "boolean":
+			value, _ = strconv.ParseBool(raw)
+		}
+		schema["default"] = value
+	}
+}
+
+// applyValidation describes validate tag rules as schema constraints
+func applyValidation(schema map[string]interface{}, field reflect.StructField) {
+	for _, rule := range splitTag(field.Tag.Get("validate")) {
+		i := strings.Index(rule, "=")
+		if i < 0 {
+			continue
+		}
+		name, arg := rule[:i], rule[i+1:]
+		if name == "oneof" {
+			enum := []interface{}{}
+			for _, option := range strings.Fields(arg) {
+				enum = append(enum, option)
+			}
+			schema["enum"] = enum
+			continue
+		}
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil || (name != "min" && name != "max") {
+			continue
+		}
+		switch schema["type"] {
+		case "string":
+			schema[name+"Length"] = int(limit)
+		case "array":
+			schema[name+"Items"] = int(limit)
+		case "object":
+			schema[name+"Properties"] = int(limit)
+		default:
+			schema[map[string]string{"min": "minimum", "max": "maximum"}[name]] = limit
+		}
+	}
+}
+
+type openAPISchemas struct {
+	names   map[reflect.Type]string
+	schemas map[string]interface{}
+}
+
+func newOpenAPISchemas() *openAPISchemas {
+	return &openAPISchemas{map[reflect.Type]string{}, map[string]interface{}{}}
+}
+
+// stringSchema describes values parsed from request strings (see parseString)
+func (schemas *openAPISchemas) stringSchema(rtype reflect.Type) map[string]interface{} {
+	if rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+	if rtype == durationType {
+		return map[string]interface{}{"type": "string", "example": "1m30s"}
+	}
+	if rtype == cookieType {
+		return map[string]interface{}{"type": "string"}
+	}
+	return schemas.schemaOf(rtype)
+}
+
+// schemaOf describes how values of rtype are encoded to JSON
+func (schemas *openAPISchemas) schemaOf(rtype reflect.Type) map[string]interface{} {
+	if rtype.Kind() == reflect.Ptr {
+		schema := schemas.schemaOf(rtype.Elem())
+		if _, isRef := schema["$ref"]; !isRef {
+			schema["nullable"] = true
+		}
+		return schema
+	}
+	switch {
+	case rtype == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rtype.Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+	switch rtype.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		if rtype.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemas.schemaOf(rtype.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemas.schemaOf(rtype.Elem())}
+	case reflect.Struct:
+		return schemas.structSchema(rtype)
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes named structs as components, so they can be shared and even be recursive
+func (schemas *openAPISchemas) structSchema(rtype reflect.Type) map[string]interface{} {
+	if rtype.Name() == "" {
+		return schemas.objectSchema(rtype)
+	}
+	name, found := schemas.names[rtype]
+	if !found {
+		name = schemas.uniqueName(rtype.Name())
+		schemas.names[rtype] = name
+		schemas.schemas[name] = map[string]interface{}{}
+		schemas.schemas[name] = schemas.objectSchema(rtype)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func (schemas *openAPISchemas) uniqueName(name string) string {
+	unique := name
+	for i := 2; schemas.schemas[unique] != nil; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	return unique
+}
+
+func (schemas *openAPISchemas) objectSchema(rtype reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	schemas.addProperties(rtype, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// addProperties follows encoding/json rules for field names, including embedded structs
+func (schemas *openAPISchemas) addProperties(rtype reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			schemas.addProperties(fieldType, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemas.schemaOf(field.Type)
+	}
+}
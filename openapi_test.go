@@ -0,0 +1,348 @@
+package gap
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type tAddress struct {
+	Street string    `json:"street"`
+	Zip    *string   `json:"zip,omitempty"`
+	Parent *tAddress `json:"parent"`
+	secret string
+}
+
+type tNotFound struct {
+	Status  int    `response:"status"`
+	Message string `response:"json,message"`
+}
+
+func (err tNotFound) Error() string {
+	return err.Message
+}
+
+func TestOpenAPI(t *testing.T) {
+
+	type tIn struct {
+		ID      int           `request:"param,id"`
+		Page    int           `request:"query,page" validate:"min=1"`
+		Timeout time.Duration `request:"header,x-timeout"`
+		Title   string        `request:"json,title" validate:"required,max=100"`
+		Address tAddress      `request:"json,address"`
+		Tags    []string      `request:"json,tags"`
+	}
+	type tOut struct {
+		Cache   string    `response:"header,Cache-Control"`
+		ID      int       `response:"json,id"`
+		Created time.Time `response:"json,created"`
+	}
+	app := New()
+	app.OpenAPIInfo("Users", "2.0.0")
+	app.Route("PUT", "/users/{id}", func(input tIn) (tOut, error) { return tOut{}, nil }).
+		Summary("Update user").
+		Errors(tNotFound{404, "user not found"}, errors.New("invalid"))
+	app.Route("DELETE", "/users/{id}", func() {})
+	app.ServeOpenAPI("/openapi.json")
+
+	encoded, _ := json.Marshal(app.OpenAPI())
+	doc := map[string]interface{}{}
+	json.Unmarshal(encoded, &doc)
+	get := func(value interface{}, keys ...interface{}) interface{} {
+		for _, key := range keys {
+			switch k := key.(type) {
+			case string:
+				value = value.(map[string]interface{})[k]
+			case int:
+				value = value.([]interface{})[k]
+			}
+		}
+		return value
+	}
+	asJSON := func(value interface{}) string {
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+	op := get(doc, "paths", "/users/{id}", "put")
+
+	t.Run("describes document info", func(t *testing.T) {
+		if doc["openapi"] != "3.0.3" || asJSON(doc["info"]) != `{"title":"Users","version":"2.0.0"}` {
+			t.Errorf("unexpected document header: %s", encoded)
+		}
+	})
+
+	t.Run("describes operations per method", func(t *testing.T) {
+		operations := get(doc, "paths", "/users/{id}").(map[string]interface{})
+		if len(operations) != 2 || operations["delete"] == nil || get(op, "summary") != "Update user" {
+			t.Errorf("unexpected operations: %s", asJSON(operations))
+		}
+	})
+
+	t.Run("describes params, query and headers as parameters", func(t *testing.T) {
+		expected := `[` +
+			`{"in":"path","name":"id","required":true,"schema":{"format":"int64","type":"integer"}},` +
+			`{"in":"query","name":"page","schema":{"format":"int64","minimum":1,"type":"integer"}},` +
+			`{"in":"header","name":"x-timeout","schema":{"example":"1m30s","type":"string"}}]`
+		if asJSON(get(op, "parameters")) != expected {
+			t.Errorf("unexpected parameters: %s", asJSON(get(op, "parameters")))
+		}
+	})
+
+	t.Run("describes path params even without a bound input", func(t *testing.T) {
+		expected := `[{"in":"path","name":"id","required":true,"schema":{"type":"string"}}]`
+		if params := get(doc, "paths", "/users/{id}", "delete", "parameters"); asJSON(params) != expected {
+			t.Errorf("unexpected parameters: %s", asJSON(params))
+		}
+	})
+
+	t.Run("describes json inputs as request body", func(t *testing.T) {
+		schema := get(op, "requestBody", "content", "application/json", "schema")
+		expected := `{"properties":{` +
+			`"address":{"$ref":"#/components/schemas/tAddress"},` +
+			`"tags":{"items":{"type":"string"},"type":"array"},` +
+			`"title":{"maxLength":100,"type":"string"}},` +
+			`"required":["title"],"type":"object"}`
+		if asJSON(schema) != expected {
+			t.Errorf("unexpected request body: %s", asJSON(schema))
+		}
+	})
+
+	t.Run("describes forms and files as multipart request body", func(t *testing.T) {
+		type tUpload struct {
+			Name   string `request:"form,name"`
+			Avatar File   `request:"file,avatar"`
+		}
+		app := New()
+		app.Route("POST", "/upload", func(input tUpload) {})
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		schema := get(doc, "paths", "/upload", "post", "requestBody", "content", "multipart/form-data", "schema")
+		expected := `{"properties":{"avatar":{"format":"binary","type":"string"},"name":{"type":"string"}},"type":"object"}`
+		if asJSON(schema) != expected {
+			t.Errorf("unexpected request body: %s", encoded)
+		}
+	})
+
+	t.Run("describes cookies as parameters and set-cookie header", func(t *testing.T) {
+		type tSession struct {
+			Session string `request:"cookie,session"`
+		}
+		type tLogin struct {
+			Session string `response:"cookie,session,httponly"`
+		}
+		app := New()
+		app.Route("POST", "/login", func(input tSession) tLogin { return tLogin{} })
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		op := get(doc, "paths", "/login", "post")
+		if asJSON(get(op, "parameters")) != `[{"in":"cookie","name":"session","schema":{"type":"string"}}]` {
+			t.Errorf("unexpected parameters: %s", asJSON(get(op, "parameters")))
+		}
+		if asJSON(get(op, "responses", "200", "headers")) != `{"Set-Cookie":{"schema":{"type":"string"}}}` {
+			t.Errorf("unexpected response: %s", asJSON(get(op, "responses", "200")))
+		}
+	})
+
+	t.Run("describes streams by their media type", func(t *testing.T) {
+		type tEvents struct {
+			Events chan Event `response:"stream,sse"`
+		}
+		type tItems struct {
+			Items func(func(tAddress) bool) `response:"stream,ndjson"`
+		}
+		app := New()
+		app.Route("GET", "/events", func() tEvents { return tEvents{} })
+		app.Route("GET", "/items", func() tItems { return tItems{} })
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		events := get(doc, "paths", "/events", "get", "responses", "200", "content")
+		if asJSON(events) != `{"text/event-stream":{"schema":{"type":"string"}}}` {
+			t.Errorf("unexpected content: %s", asJSON(events))
+		}
+		items := get(doc, "paths", "/items", "get", "responses", "200", "content")
+		if asJSON(items) != `{"application/x-ndjson":{"schema":{"$ref":"#/components/schemas/tAddress"}}}` {
+			t.Errorf("unexpected content: %s", asJSON(items))
+		}
+	})
+
+	t.Run("describes embedded fields and pointer structs", func(t *testing.T) {
+		type tPagination struct {
+			Page int `request:"query,page"`
+		}
+		type tList struct {
+			tPagination
+			Sort string `request:"query,sort"`
+		}
+		type tTotal struct {
+			Total int `response:"json,total"`
+		}
+		type tListOut struct {
+			tTotal
+		}
+		app := New()
+		app.Route("GET", "/users", func(input *tList) *tListOut { return nil })
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		op := get(doc, "paths", "/users", "get")
+		expected := `[` +
+			`{"in":"query","name":"page","schema":{"format":"int64","type":"integer"}},` +
+			`{"in":"query","name":"sort","schema":{"type":"string"}}]`
+		if asJSON(get(op, "parameters")) != expected {
+			t.Errorf("unexpected parameters: %s", asJSON(get(op, "parameters")))
+		}
+		schema := get(op, "responses", "200", "content", "application/json", "schema")
+		if asJSON(schema) != `{"properties":{"total":{"format":"int64","type":"integer"}},"type":"object"}` {
+			t.Errorf("unexpected response: %s", asJSON(schema))
+		}
+	})
+
+	t.Run("describes input defaults and required options", func(t *testing.T) {
+		type tList struct {
+			Page   int    `request:"query,page,default=1"`
+			Sort   string `request:"query,sort,default=name"`
+			Tenant string `request:"header,x-tenant,required"`
+		}
+		app := New()
+		app.Route("GET", "/users", func(input tList) {})
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		expected := `[` +
+			`{"in":"query","name":"page","schema":{"default":1,"format":"int64","type":"integer"}},` +
+			`{"in":"query","name":"sort","schema":{"default":"name","type":"string"}},` +
+			`{"in":"header","name":"x-tenant","required":true,"schema":{"type":"string"}}]`
+		if parameters := asJSON(get(doc, "paths", "/users", "get", "parameters")); parameters != expected {
+			t.Errorf("unexpected parameters: %s", parameters)
+		}
+	})
+
+	t.Run("describes multi-value and deep object query parameters", func(t *testing.T) {
+		type tSearch struct {
+			Tags   []string          `request:"query,tag"`
+			IDs    []int             `request:"query,ids,comma"`
+			Filter map[string]string `request:"query,filter"`
+		}
+		app := New()
+		app.Route("GET", "/search", func(input tSearch) {})
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		expected := `[` +
+			`{"in":"query","name":"tag","schema":{"items":{"type":"string"},"type":"array"}},` +
+			`{"explode":false,"in":"query","name":"ids","schema":{"items":{"format":"int64","type":"integer"},"type":"array"}},` +
+			`{"explode":true,"in":"query","name":"filter","schema":{"additionalProperties":{"type":"string"},"type":"object"},"style":"deepObject"}]`
+		if parameters := asJSON(get(doc, "paths", "/search", "get", "parameters")); parameters != expected {
+			t.Errorf("unexpected parameters: %s", parameters)
+		}
+	})
+
+	t.Run("describes named structs as components", func(t *testing.T) {
+		expected := `{"properties":{` +
+			`"parent":{"$ref":"#/components/schemas/tAddress"},` +
+			`"street":{"type":"string"},` +
+			`"zip":{"nullable":true,"type":"string"}},"type":"object"}`
+		if asJSON(get(doc, "components", "schemas", "tAddress")) != expected {
+			t.Errorf("unexpected component: %s", asJSON(get(doc, "components", "schemas")))
+		}
+	})
+
+	t.Run("describes output as success response", func(t *testing.T) {
+		expected := `{"properties":{` +
+			`"created":{"format":"date-time","type":"string"},` +
+			`"id":{"format":"int64","type":"integer"}},"type":"object"}`
+		if asJSON(get(op, "responses", "200", "content", "application/json", "schema")) != expected {
+			t.Errorf("unexpected response: %s", asJSON(get(op, "responses", "200")))
+		}
+		if get(op, "responses", "200", "description") != "OK" ||
+			asJSON(get(op, "responses", "200", "headers")) != `{"Cache-Control":{"schema":{"type":"string"}}}` {
+			t.Errorf("unexpected response: %s", asJSON(get(op, "responses", "200")))
+		}
+	})
+
+	t.Run("describes output content for every encoder", func(t *testing.T) {
+		content := get(op, "responses", "200", "content").(map[string]interface{})
+		for _, enc := range app.encoders {
+			if content[enc.mime] == nil {
+				t.Errorf("missing content for %s", enc.mime)
+			}
+		}
+	})
+
+	t.Run("describes declared errors by status", func(t *testing.T) {
+		notFound := `{"properties":{"message":{"type":"string"}},"type":"object"}`
+		if get(op, "responses", "404", "description") != "Not Found" ||
+			asJSON(get(op, "responses", "404", "content", "application/json", "schema")) != notFound {
+			t.Errorf("unexpected not found response: %s", asJSON(get(op, "responses", "404")))
+		}
+		badRequest := `{"properties":{"error":{"type":"string"},"problems":{"items":{"properties":{` +
+			`"key":{"type":"string"},"reason":{"type":"string"},"source":{"type":"string"}},"type":"object"},"type":"array"}},"type":"object"}`
+		if get(op, "responses", "400", "description") != "Bad Request" ||
+			asJSON(get(op, "responses", "400", "content", "application/json", "schema")) != badRequest {
+			t.Errorf("unexpected bad request response: %s", asJSON(get(op, "responses", "400")))
+		}
+	})
+
+	t.Run("describes timeouts and not acceptable responses", func(t *testing.T) {
+		app := New()
+		app.Route("GET", "/slow", func() {}).Timeout(time.Second)
+		app.Route("GET", "/users", func() tOut { return tOut{} })
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		slow := get(doc, "paths", "/slow", "get", "responses").(map[string]interface{})
+		if get(slow, "503", "description") != "Service Unavailable" || slow["406"] != nil {
+			t.Errorf("unexpected timed responses: %s", asJSON(slow))
+		}
+		users := get(doc, "paths", "/users", "get", "responses").(map[string]interface{})
+		notAcceptable := get(users, "406", "content")
+		if users["503"] != nil || len(notAcceptable.(map[string]interface{})) != 1 || get(notAcceptable, "application/json") == nil {
+			t.Errorf("unexpected encoded responses: %s", asJSON(users))
+		}
+	})
+
+	t.Run("describes errors with pointer receivers by their tags", func(t *testing.T) {
+		app := New()
+		app.Route("GET", "/users", func() error { return nil }).Errors(&tPtrErr{404, "user not found"})
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		schema := get(doc, "paths", "/users", "get", "responses", "404", "content", "application/json", "schema")
+		if asJSON(schema) != `{"properties":{"message":{"type":"string"}},"type":"object"}` {
+			t.Errorf("unexpected not found response: %s", encoded)
+		}
+	})
+
+	t.Run("describes plain errors as problem details on problem details mode", func(t *testing.T) {
+		app := New()
+		app.ProblemDetails(true)
+		app.Route("GET", "/users", func() error { return nil }).Errors(tNotFound{404, "user not found"})
+		encoded, _ := json.Marshal(app.OpenAPI())
+		doc := map[string]interface{}{}
+		json.Unmarshal(encoded, &doc)
+		responses := get(doc, "paths", "/users", "get", "responses")
+		badRequest := get(responses, "400", "content").(map[string]interface{})
+		if len(badRequest) != 1 || get(badRequest, "application/problem+json", "schema", "properties", "detail") == nil {
+			t.Errorf("unexpected bad request response: %s", asJSON(badRequest))
+		}
+		if get(responses, "404", "content", "application/json") == nil {
+			t.Errorf("unexpected not found response: %s", asJSON(get(responses, "404")))
+		}
+	})
+
+	t.Run("serves document leaving its own route out", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/openapi.json", nil))
+		if response.Code != 200 || response.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected response: %d", response.Code)
+		}
+		if response.Body.String() != string(encoded) {
+			t.Errorf("unexpected body: %s", response.Body.String())
+		}
+	})
+}
@@ -1,30 +1,103 @@
 package gap
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	stringType    = reflect.TypeOf("")
+	cookieType    = reflect.TypeOf(http.Cookie{})
+	cookiePtrType = reflect.TypeOf(&http.Cookie{})
+	intType       = reflect.TypeOf(0)
+	readerType    = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
 )
 
 type outputField interface {
 	write(response *lazyResponse, value reflect.Value)
 }
 
-func newOutputField(field reflect.StructField) outputField {
+func newOutputField(field reflect.StructField, writers map[string]OutputWriter) outputField {
 	tagParts := splitTag(field.Tag.Get("response"))
 	if len(tagParts) == 2 && tagParts[0] == "header" {
+		if field.Type != stringType {
+			panic(unsupportedOutput("string"))
+		}
 		return headerOutput{tagParts[1]}
 	}
-	if len(tagParts) == 2 && tagParts[0] == "json" {
-		return jsonOutput{tagParts[1]}
+	if len(tagParts) == 2 && (tagParts[0] == "field" || tagParts[0] == "json") {
+		if !encodable(field.Type, map[reflect.Type]bool{}) {
+			panic(unsupportedOutput("encodable value"))
+		}
+		return fieldOutput{tagParts[1]}
 	}
 	if len(tagParts) == 1 && tagParts[0] == "status" {
+		if field.Type != intType {
+			panic(unsupportedOutput("int"))
+		}
 		return statusOutput{}
 	}
 	if len(tagParts) == 1 && tagParts[0] == "body" {
+		if !field.Type.Implements(readerType) {
+			panic(unsupportedOutput("io.Reader"))
+		}
 		return bodyOutput{}
 	}
-	panic(errors.New("missing or invalid response tag on output field"))
+	if len(tagParts) == 2 && tagParts[0] == "stream" {
+		return newStreamOutput(field.Type, tagParts[1])
+	}
+	if len(tagParts) >= 2 && tagParts[0] == "cookie" {
+		if field.Type != stringType && field.Type != cookieType && field.Type != cookiePtrType {
+			panic(unsupportedOutput("string, http.Cookie or *http.Cookie"))
+		}
+		return newCookieOutput(tagParts[1], tagParts[2:])
+	}
+	if writer, found := writers[tagParts[0]]; found && len(tagParts) <= 2 {
+		key := ""
+		if len(tagParts) == 2 {
+			key = tagParts[1]
+		}
+		return customOutput{key, writer}
+	}
+	panic(invalidOutputTag)
+}
+
+var invalidOutputTag = fieldError{tag: "response", reason: "missing or invalid response tag on output field"}
+
+func unsupportedOutput(expected string) fieldError {
+	return fieldError{"response", "unsupported type on output field", expected}
+}
+
+// encodable tells if values of rtype can be encoded, which rules out channels, functions and unsafe pointers anywhere
+// in them. Types encoding themselves are trusted to do so.
+func encodable(rtype reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[rtype] || rtype.Implements(marshalerType) || reflect.PtrTo(rtype).Implements(marshalerType) ||
+		rtype.Implements(textMarshalerType) || reflect.PtrTo(rtype).Implements(textMarshalerType) {
+		return true
+	}
+	seen[rtype] = true
+	switch rtype.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return false
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return encodable(rtype.Elem(), seen)
+	case reflect.Map:
+		return encodable(rtype.Key(), seen) && encodable(rtype.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < rtype.NumField(); i++ {
+			field := rtype.Field(i)
+			if (field.PkgPath == "" || field.Anonymous) && field.Tag.Get("json") != "-" && !encodable(field.Type, seen) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 type headerOutput struct {
@@ -38,13 +111,83 @@ func (output headerOutput) write(response *lazyResponse, value reflect.Value) {
 	}
 }
 
-type jsonOutput struct {
+type fieldOutput struct {
 	key string
 }
 
-func (output jsonOutput) write(response *lazyResponse, value reflect.Value) {
-	response.httpResponse.Header().Set("Content-Type", "application/json")
-	response.setJSON(output.key, value.Interface())
+func (output fieldOutput) write(response *lazyResponse, value reflect.Value) {
+	response.setField(output.key, value.Interface())
+}
+
+type cookieOutput struct {
+	template http.Cookie
+}
+
+// newCookieOutput parses cookie attributes from tag options (e.g. path=/,maxage=3600,secure,httponly,samesite=lax)
+func newCookieOutput(name string, options []string) cookieOutput {
+	cookie := http.Cookie{Name: name}
+	for _, option := range options {
+		key, value := option, ""
+		if i := strings.Index(option, "="); i >= 0 {
+			key, value = option[:i], option[i+1:]
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "path":
+			cookie.Path = value
+		case "domain":
+			cookie.Domain = value
+		case "maxage":
+			cookie.MaxAge, err = strconv.Atoi(value)
+		case "secure":
+			cookie.Secure = true
+		case "httponly":
+			cookie.HttpOnly = true
+		case "samesite":
+			cookie.SameSite, err = parseSameSite(value)
+		default:
+			err = errors.New("unknown option")
+		}
+		if err != nil {
+			panic(fieldError{tag: "response", reason: "invalid cookie option on output field"})
+		}
+	}
+	return cookieOutput{cookie}
+}
+
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, errors.New("invalid samesite")
+}
+
+func (output cookieOutput) write(response *lazyResponse, value reflect.Value) {
+	var cookie http.Cookie
+	switch v := value.Interface().(type) {
+	case string:
+		if v == "" {
+			return
+		}
+		cookie = output.template
+		cookie.Value = v
+	case http.Cookie:
+		cookie = v
+	case *http.Cookie:
+		if v == nil {
+			return
+		}
+		cookie = *v
+	}
+	if cookie.Name == "" {
+		cookie.Name = output.template.Name
+	}
+	http.SetCookie(response.httpResponse, &cookie)
 }
 
 type statusOutput struct{}
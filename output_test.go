@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -29,7 +32,7 @@ func TestOutput(t *testing.T) {
 		fn := func(input tIn) (tOut, error) {
 			return tOut{"application/json", "no-cache"}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -41,6 +44,77 @@ func TestOutput(t *testing.T) {
 		}
 	})
 
+	t.Run("can output to cookies", func(t *testing.T) {
+		type tOut struct {
+			Session string       `response:"cookie,session,path=/,maxage=3600,secure,httponly,samesite=strict"`
+			Theme   http.Cookie  `response:"cookie,theme"`
+			Lang    *http.Cookie `response:"cookie,lang"`
+			Empty   string       `response:"cookie,empty"`
+		}
+		fn := func() tOut {
+			return tOut{Session: "abc", Theme: http.Cookie{Value: "dark", SameSite: http.SameSiteLaxMode}}
+		}
+		ep := newEndpoint(fn, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		cookies := response.Result().Header.Values("Set-Cookie")
+		sort.Strings(cookies)
+		expected := []string{
+			"session=abc; Path=/; Max-Age=3600; HttpOnly; Secure; SameSite=Strict",
+			"theme=dark; SameSite=Lax",
+		}
+		if strings.Join(cookies, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("unexpected cookies: %q", cookies)
+		}
+	})
+
+	t.Run("cookie outputs validate types and options", func(t *testing.T) {
+		type tCount struct {
+			Count int `response:"cookie,count"`
+		}
+		type tOption struct {
+			Session string `response:"cookie,session,samesite=sometimes"`
+		}
+		func() {
+			defer assertTagPanics(t, "unsupported type on output field")
+			newEndpoint(func() tCount { return tCount{} }, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "invalid cookie option on output field")
+			newEndpoint(func() tOption { return tOption{} }, New())
+		}()
+	})
+
+	t.Run("json outputs must be encodable", func(t *testing.T) {
+		type tItem struct {
+			Done   func()
+			hidden chan int
+			Skip   chan int `json:"-"`
+		}
+		type tChan struct {
+			Events chan int `response:"json,events"`
+		}
+		type tNested struct {
+			Items map[string][]tItem `response:"field,items"`
+		}
+		type tFine struct {
+			Item json.RawMessage `response:"json,item"`
+			Tree *tFineTree      `response:"json,tree"`
+		}
+		for _, fn := range []interface{}{
+			func() tChan { return tChan{} },
+			func() tNested { return tNested{} },
+		} {
+			func() {
+				defer assertTagPanics(t, "unsupported type on output field")
+				newEndpoint(fn, New())
+			}()
+		}
+		defer assertDoesNotPanic(t)
+		newEndpoint(func() tFine { return tFine{} }, New())
+	})
+
 	t.Run("can output to json", func(t *testing.T) {
 		type tIn struct{}
 		type tOut struct {
@@ -50,7 +124,7 @@ func TestOutput(t *testing.T) {
 		fn := func(input tIn) (tOut, error) {
 			return tOut{"lorem ipsum", true}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -64,6 +138,82 @@ func TestOutput(t *testing.T) {
 		}
 	})
 
+	t.Run("can output to encoded fields", func(t *testing.T) {
+		type tOut struct {
+			Title string `response:"field,title"`
+			Count int    `response:"json,count"`
+		}
+		ep := newEndpoint(func() tOut { return tOut{"lorem", 2} }, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Header().Get("content-type") != "application/json" || response.Body.String() != `{"count":2,"title":"lorem"}` {
+			t.Errorf("failed to output fields: %s", response.Body.String())
+		}
+	})
+
+	t.Run("encodes fields according to accept header", func(t *testing.T) {
+		type tOut struct {
+			Title string `response:"field,title"`
+		}
+		ep := newEndpoint(func() tOut { return tOut{"lorem"} }, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request.Header.Set("Accept", "application/xml")
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Header().Get("content-type") != "application/xml" ||
+			!strings.HasSuffix(response.Body.String(), "<response><title>lorem</title></response>") {
+			t.Errorf("failed to output xml: %s", response.Body.String())
+		}
+	})
+
+	t.Run("errors are encoded according to accept header", func(t *testing.T) {
+		ep := newEndpoint(func() error { return errors.New("ops") }, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request.Header.Set("Accept", "application/xml")
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Code != 400 || !strings.HasSuffix(response.Body.String(), "<response><error>ops</error></response>") {
+			t.Errorf("failed to output xml error: %s", response.Body.String())
+		}
+	})
+
+	t.Run("can encode fields with codecs registered on app", func(t *testing.T) {
+		type tOut struct {
+			Title string `response:"field,title"`
+		}
+		app := New()
+		app.Encoder("text/plain", CodecFunc(func(writer io.Writer, value interface{}) error {
+			_, err := io.WriteString(writer, value.(map[string]interface{})["title"].(string))
+			return err
+		}))
+		ep := newEndpoint(func() tOut { return tOut{"lorem"} }, app)
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request.Header.Set("Accept", "text/plain")
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Header().Get("content-type") != "text/plain" || response.Body.String() != "lorem" {
+			t.Errorf("failed to output with custom codec: %s", response.Body.String())
+		}
+	})
+
+	t.Run("answers not acceptable if no encoder matches accept header", func(t *testing.T) {
+		type tOut struct {
+			Title string `response:"field,title"`
+		}
+		ep := newEndpoint(func() tOut {
+			t.Error("endpoint should not be called")
+			return tOut{}
+		}, New())
+		request := httptest.NewRequest("GET", "/hello", nil)
+		request.Header.Set("Accept", "text/html")
+		response := httptest.NewRecorder()
+		ep.handle(request, response)
+		if response.Code != 406 || response.Body.String() != `{"error":"not acceptable"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
 	t.Run("can output to http status", func(t *testing.T) {
 		type tIn struct{}
 		type tOut struct {
@@ -72,7 +222,7 @@ func TestOutput(t *testing.T) {
 		fn := func(input tIn) (tOut, error) {
 			return tOut{201}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -90,7 +240,7 @@ func TestOutput(t *testing.T) {
 			body := strings.NewReader("lorem ipsum")
 			return tOut{body}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -107,7 +257,7 @@ func TestOutput(t *testing.T) {
 		fn := func(input tIn) (tOut, error) {
 			return tOut{}, errors.New("validation error")
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -127,7 +277,7 @@ func TestOutput(t *testing.T) {
 		fn := func(input tIn) (tOut, error) {
 			return tOut{}, tErr{401, "auth error"}
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -149,7 +299,7 @@ func TestOutput(t *testing.T) {
 		fn := func(input tIn) (tOut, error) {
 			return tOut{"image/jpeg"}, nil
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("POST", "/post", nil)
 		request.Header.Set("content-type", "application/json")
 		response := httptest.NewRecorder()
@@ -166,7 +316,7 @@ func TestOutput(t *testing.T) {
 		fn := func(input tIn) (tOut, error) {
 			panic(tErr{401, "auth error"})
 		}
-		ep := newEndpoint(fn)
+		ep := newEndpoint(fn, New())
 		request := httptest.NewRequest("GET", "/hello", nil)
 		response := httptest.NewRecorder()
 		ep.handle(request, response)
@@ -179,4 +329,93 @@ func TestOutput(t *testing.T) {
 			t.Error("failed to output json body with message")
 		}
 	})
+
+	t.Run("embedded structs are flattened", func(t *testing.T) {
+		type tMeta struct {
+			Total int    `response:"field,total"`
+			Cache string `response:"header,Cache-Control"`
+		}
+		type tOut struct {
+			tMeta
+			Items  []string `response:"field,items"`
+			Hidden string
+			secret string `response:"field,secret"`
+		}
+		ep := newEndpoint(func() tOut { return tOut{tMeta{1, "no-cache"}, []string{"a"}, "hidden", "secret"} }, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Body.String() != `{"items":["a"],"total":1}` || response.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("unexpected response: %v %s", response.Header(), response.Body.String())
+		}
+	})
+
+	t.Run("embedded struct pointers are flattened, skipping nil ones", func(t *testing.T) {
+		type tMeta struct {
+			Total int `response:"field,total"`
+		}
+		type tOut struct {
+			*tMeta
+			Items []string `response:"field,items"`
+		}
+		out := tOut{&tMeta{1}, []string{"a"}}
+		ep := newEndpoint(func() tOut { return out }, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Body.String() != `{"items":["a"],"total":1}` {
+			t.Errorf("unexpected response: %s", response.Body.String())
+		}
+		out.tMeta = nil
+		response = httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Body.String() != `{"items":["a"]}` {
+			t.Errorf("unexpected response: %s", response.Body.String())
+		}
+	})
+
+	t.Run("recursive embedded pointers are flattened once", func(t *testing.T) {
+		type tNode struct {
+			Name string `response:"field,name"`
+		}
+		type tTree struct {
+			*tTree
+			tNode
+		}
+		if fields := taggedFields(reflect.TypeOf(tTree{}), "response"); len(fields) != 1 || fields[0].Name != "Name" {
+			t.Errorf("unexpected fields: %+v", fields)
+		}
+	})
+
+	t.Run("error structs with pointer receivers are written by their tags", func(t *testing.T) {
+		ep := newEndpoint(func() error { return &tPtrErr{404, "nope"} }, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 404 || response.Body.String() != `{"message":"nope"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("error structs can have embedded fields", func(t *testing.T) {
+		type tErrEmbed struct {
+			tErr
+		}
+		ep := newEndpoint(func() error { return tErrEmbed{tErr{401, "auth error"}} }, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/hello", nil), response)
+		if response.Code != 401 || response.Body.String() != `{"message":"auth error"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+}
+
+type tPtrErr struct {
+	Status  int    `response:"status"`
+	Message string `response:"json,message"`
+}
+
+func (err *tPtrErr) Error() string {
+	return err.Message
+}
+
+type tFineTree struct {
+	Children []*tFineTree `json:"children"`
 }
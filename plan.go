@@ -0,0 +1,140 @@
+package gap
+
+import (
+	"reflect"
+)
+
+// inputPlan binds a request value to an input field, found by index so there are no name lookups per request
+type inputPlan struct {
+	index  []int
+	input  inputField
+	assign func(target reflect.Value, value reflect.Value)
+}
+
+func newInputPlan(field reflect.StructField, input inputField) inputPlan {
+	return inputPlan{field.Index, input, newAssigner(field.Type)}
+}
+
+// newAssigner picks a setter for fields of rtype, avoiding conversions on basic kinds.
+// Values read from the request are of the field kind, although their named type may differ.
+func newAssigner(rtype reflect.Type) func(target reflect.Value, value reflect.Value) {
+	switch rtype.Kind() {
+	case reflect.String:
+		return func(target reflect.Value, value reflect.Value) { target.SetString(value.String()) }
+	case reflect.Bool:
+		return func(target reflect.Value, value reflect.Value) { target.SetBool(value.Bool()) }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(target reflect.Value, value reflect.Value) { target.SetInt(value.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(target reflect.Value, value reflect.Value) { target.SetUint(value.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		return func(target reflect.Value, value reflect.Value) { target.SetFloat(value.Float()) }
+	}
+	return func(target reflect.Value, value reflect.Value) {
+		if value.Type() != rtype {
+			value = value.Convert(rtype)
+		}
+		target.Set(value)
+	}
+}
+
+// outputPlan writes an output field, in the order fields are declared
+type outputPlan struct {
+	index  []int
+	output outputField
+}
+
+func newOutputPlans(function string, rtype reflect.Type, writers map[string]OutputWriter) ([]outputPlan, TagErrors) {
+	plans := []outputPlan{}
+	errs := checkFields(function, rtype, "response", func(field reflect.StructField) {
+		plans = append(plans, outputPlan{field.Index, newOutputField(field, writers)})
+	})
+	return plans, errs
+}
+
+// errorPlans returns the output plans of error structs, which are only known once returned.
+// They are cached on the app, since custom output kinds are registered per app.
+// Invalid tags panic, as they are only found once the error is returned by function.
+func (app *App) errorPlans(function string, rtype reflect.Type) []outputPlan {
+	if plans, found := app.errorPlanCache.Load(rtype); found {
+		return plans.([]outputPlan)
+	}
+	plans, errs := newOutputPlans(function, rtype, app.outputWriters)
+	if len(errs) > 0 {
+		panic(errs)
+	}
+	cached, _ := app.errorPlanCache.LoadOrStore(rtype, plans)
+	return cached.([]outputPlan)
+}
+
+// taggedFields lists the exported fields carrying tag, flattening untagged embedded structs and struct pointers.
+func taggedFields(rtype reflect.Type, tag string) []reflect.StructField {
+	return embeddedFields(rtype, tag, map[reflect.Type]bool{rtype: true})
+}
+
+// embeddedFields lists the tagged fields of rtype, skipping structs already being flattened, as pointers can embed them
+func embeddedFields(rtype reflect.Type, tag string, flattening map[reflect.Type]bool) []reflect.StructField {
+	fields := []reflect.StructField{}
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		if field.Tag.Get(tag) == "" {
+			if inner := structElem(field.Type); field.Anonymous && inner != nil && !flattening[inner] {
+				flattening[inner] = true
+				for _, innerField := range embeddedFields(inner, tag, flattening) {
+					innerField.Index = append([]int{i}, innerField.Index...)
+					fields = append(fields, innerField)
+				}
+				delete(flattening, inner)
+			}
+			continue
+		}
+		if field.PkgPath == "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// unexportedPointer tells if the field at index is reached through an embedded pointer to an unexported struct,
+// which can't be allocated
+func unexportedPointer(rtype reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		field := rtype.Field(i)
+		rtype = field.Type
+		if rtype.Kind() == reflect.Ptr {
+			if field.PkgPath != "" {
+				return true
+			}
+			rtype = rtype.Elem()
+		}
+	}
+	return false
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, allocating the nil embedded pointers on the way
+func fieldByIndex(value reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		value = value.Field(x)
+	}
+	return value
+}
+
+// lookupField is like reflect.Value.FieldByIndex, but reports false when an embedded pointer on the way is nil
+func lookupField(value reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		value = value.Field(x)
+	}
+	return value, true
+}
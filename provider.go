@@ -0,0 +1,19 @@
+package gap
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+var requestType = reflect.TypeOf((*http.Request)(nil))
+
+func newProvider(fn interface{}) (reflect.Type, reflect.Value) {
+	rtype := reflect.TypeOf(fn)
+	if rtype == nil || rtype.Kind() != reflect.Func ||
+		rtype.NumIn() != 1 || rtype.In(0) != requestType ||
+		rtype.NumOut() != 2 || !typeIsError(rtype.Out(1)) {
+		panic(errors.New("invalid provider interface"))
+	}
+	return rtype.Out(0), reflect.ValueOf(fn)
+}
@@ -0,0 +1,114 @@
+package gap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type tUser struct {
+	Name string
+}
+
+type tDB struct {
+	calls int
+}
+
+func TestProvider(t *testing.T) {
+
+	t.Run("can be constructed from functions with the provider interface", func(t *testing.T) {
+		defer assertDoesNotPanic(t)
+		newProvider(func(request *http.Request) (tUser, error) { return tUser{}, nil })
+		newProvider(func(request *http.Request) (*tDB, error) { return nil, nil })
+	})
+
+	t.Run("cannot be constructed from functions with invalid interfaces", func(t *testing.T) {
+		functions := []interface{}{
+			nil,
+			"not a function",
+			func() (tUser, error) { return tUser{}, nil },
+			func(request http.Request) (tUser, error) { return tUser{}, nil },
+			func(request *http.Request) tUser { return tUser{} },
+			func(request *http.Request) (tUser, tUser) { return tUser{}, tUser{} },
+		}
+		for i, fn := range functions {
+			t.Run(fmt.Sprintf("function %d", i+1), func(t *testing.T) {
+				defer assertPanics(t, "invalid provider interface")
+				newProvider(fn)
+			})
+		}
+	})
+
+	t.Run("app rejects duplicate providers", func(t *testing.T) {
+		defer assertPanics(t, "duplicate provider")
+		app := New()
+		app.Provide(func(request *http.Request) (tUser, error) { return tUser{}, nil })
+		app.Provide(func(request *http.Request) (tUser, error) { return tUser{}, nil })
+	})
+
+	t.Run("endpoints can take provided values alongside input", func(t *testing.T) {
+		type tIn struct {
+			Title string `request:"query,title"`
+		}
+		type tOut struct {
+			Message string `response:"json,message"`
+		}
+		db := &tDB{}
+		app := New()
+		app.Provide(func(request *http.Request) (*tDB, error) { return db, nil })
+		app.Provide(func(request *http.Request) (tUser, error) {
+			return tUser{request.Header.Get("x-user")}, nil
+		})
+		app.Route("GET", "/hello", func(user tUser, input tIn, db *tDB) tOut {
+			db.calls++
+			return tOut{user.Name + ": " + input.Title}
+		})
+		request := httptest.NewRequest("GET", "/hello?title=lorem", nil)
+		request.Header.Set("x-user", "john")
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Body.String() != `{"message":"john: lorem"}` || db.calls != 1 {
+			t.Errorf("failed to provide values: %s", response.Body.String())
+		}
+	})
+
+	t.Run("provided struct types are not taken as input", func(t *testing.T) {
+		app := New()
+		app.Provide(func(request *http.Request) (tUser, error) { return tUser{"john"}, nil })
+		ep := newEndpoint(func(user tUser, input struct{}) {}, app)
+		if ep.inIndex != 1 {
+			t.Errorf("unexpected input index: %d", ep.inIndex)
+		}
+	})
+
+	t.Run("endpoints cannot take types without provider", func(t *testing.T) {
+		defer assertPanics(t, "invalid endpoint interface")
+		newEndpoint(func(db *tDB) {}, New())
+	})
+
+	t.Run("provider errors are answered like endpoint errors", func(t *testing.T) {
+		type testCase struct {
+			err    error
+			status int
+			body   string
+		}
+		cases := []testCase{
+			testCase{errors.New("missing user"), 400, `{"error":"missing user"}`},
+			testCase{tErr{401, "auth error"}, 401, `{"message":"auth error"}`},
+		}
+		for _, tcase := range cases {
+			t.Run(tcase.err.Error(), func(t *testing.T) {
+				app := New()
+				app.Provide(func(request *http.Request) (tUser, error) { return tUser{}, tcase.err })
+				app.Route("GET", "/hello", func(user tUser) { t.Error("endpoint should not be called") })
+				response := httptest.NewRecorder()
+				app.ServeHTTP(response, httptest.NewRequest("GET", "/hello", nil))
+				if response.Code != tcase.status || response.Body.String() != tcase.body {
+					t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package gap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type routePath struct {
+	path     string
+	segments []segment
+	routes   map[string]*Route
+}
+
+// Route is an endpoint bound to a method and path.
+// It's returned when routing, so the route can be further described.
+type Route struct {
+	method     string
+	endpoint   endpoint
+	middleware []Middleware
+	group      *Group
+	summary    string
+	errors     []error
+	hidden     bool
+	chain      handlerCache
+}
+
+type segment struct {
+	value string
+	param bool
+}
+
+type routeKey struct{}
+
+type routeMatch struct {
+	path   string
+	params map[string]string
+}
+
+func newRoutePath(path string) *routePath {
+	return &routePath{path, parsePath(path), map[string]*Route{}}
+}
+
+func (rp *routePath) add(rt *Route) {
+	if _, found := rp.routes[rt.method]; found {
+		panic(errors.New("duplicate route"))
+	}
+	rp.routes[rt.method] = rt
+}
+
+func (rp *routePath) methods() []string {
+	methods := make([]string, 0, len(rp.routes))
+	for method := range rp.routes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func parsePath(path string) []segment {
+	if !strings.HasPrefix(path, "/") {
+		panic(errors.New("invalid route path"))
+	}
+	parts := strings.Split(path, "/")[1:]
+	segments := make([]segment, len(parts))
+	names := map[string]bool{}
+	for i, part := range parts {
+		if !strings.ContainsAny(part, "{}") {
+			segments[i] = segment{part, false}
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+		if len(name) != len(part)-2 || name == "" || strings.ContainsAny(name, "{}") || names[name] {
+			panic(errors.New("invalid route path"))
+		}
+		names[name] = true
+		segments[i] = segment{name, true}
+	}
+	return segments
+}
+
+func (rp *routePath) match(parts []string) (map[string]string, bool) {
+	if len(parts) != len(rp.segments) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, seg := range rp.segments {
+		if !seg.param {
+			if seg.value != parts[i] {
+				return nil, false
+			}
+			continue
+		}
+		if parts[i] == "" {
+			return nil, false
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[seg.value] = parts[i]
+	}
+	return params, true
+}
+
+// moreSpecific tells if rp should take precedence over other when both match a path.
+// Static segments win over params at the first position where the paths differ.
+func (rp *routePath) moreSpecific(other *routePath) bool {
+	for i, seg := range rp.segments {
+		if seg.param != other.segments[i].param {
+			return !seg.param
+		}
+	}
+	return false
+}
+
+func splitPath(request *http.Request) []string {
+	parts := strings.Split(request.URL.EscapedPath(), "/")[1:]
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err == nil {
+			parts[i] = unescaped
+		}
+	}
+	return parts
+}
+
+// Summary sets a short description of the route, used on the OpenAPI document
+func (rt *Route) Summary(summary string) *Route {
+	rt.summary = summary
+	return rt
+}
+
+// Errors declares errors the endpoint may return, so they're described on the OpenAPI document.
+// Errors that are output structs are described with their status and fields, others as 400 responses.
+func (rt *Route) Errors(errs ...error) *Route {
+	rt.errors = append(rt.errors, errs...)
+	return rt
+}
+
+// Timeout limits how long the endpoint can take. Once it's over, the endpoint context is canceled
+// and the request is answered with 503 Service Unavailable. WebSocket routes are not limited.
+func (rt *Route) Timeout(timeout time.Duration) *Route {
+	rt.endpoint.timeout = timeout
+	return rt
+}
+
+// handler builds the middleware chain of the route, app middleware being the outermost one
+func (rt *Route) handler() http.Handler {
+	handler := http.Handler(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		rt.endpoint.handle(request, response)
+	}))
+	return chain(rt.endpoint.app.middleware, rt.group.wrap(chain(rt.middleware, handler)))
+}
+
+func withRoute(request *http.Request, path string, params map[string]string) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), routeKey{}, routeMatch{path, params}))
+}
+
+func getParams(request *http.Request) map[string]string {
+	match, _ := request.Context().Value(routeKey{}).(routeMatch)
+	return match.params
+}
+
+// RoutePath returns the path of the route matching the request, as it was given to App.Route (e.g. /users/{id}).
+// It's empty if no route matched.
+func RoutePath(request *http.Request) string {
+	match, _ := request.Context().Value(routeKey{}).(routeMatch)
+	return match.path
+}
+
+// Param returns the value of a path param from the route matching the request
+func Param(request *http.Request, key string) string {
+	return getParams(request)[key]
+}
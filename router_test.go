@@ -0,0 +1,92 @@
+package gap
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+
+	t.Run("accepts static and parameterized paths", func(t *testing.T) {
+		defer assertDoesNotPanic(t)
+		parsePath("/")
+		parsePath("/users")
+		parsePath("/users/{id}")
+		parsePath("/users/{id}/posts/{postID}")
+	})
+
+	t.Run("rejects invalid paths", func(t *testing.T) {
+		paths := []string{
+			"users",
+			"/users/{}",
+			"/users/{id",
+			"/users/id}",
+			"/users/x{id}",
+			"/users/{{id}}",
+			"/users/{id}/posts/{id}",
+		}
+		for _, path := range paths {
+			t.Run(path, func(t *testing.T) {
+				defer assertPanics(t, "invalid route path")
+				parsePath(path)
+			})
+		}
+	})
+
+	t.Run("matches paths against templates", func(t *testing.T) {
+		type testCase struct {
+			template string
+			path     string
+			match    bool
+			params   map[string]string
+		}
+		cases := []testCase{
+			testCase{"/", "/", true, nil},
+			testCase{"/users", "/users", true, nil},
+			testCase{"/users", "/users/", false, nil},
+			testCase{"/users/{id}", "/users/42", true, map[string]string{"id": "42"}},
+			testCase{"/users/{id}", "/users/", false, nil},
+			testCase{"/users/{id}", "/users/42/posts", false, nil},
+			testCase{"/users/{id}/posts/{postID}", "/users/42/posts/7", true, map[string]string{"id": "42", "postID": "7"}},
+			testCase{"/files/{name}", "/files/a%2Fb", true, map[string]string{"name": "a/b"}},
+		}
+		for i, tcase := range cases {
+			t.Run(fmt.Sprintf("case %d", i+1), func(t *testing.T) {
+				rp := newRoutePath(tcase.template)
+				request := httptest.NewRequest("GET", tcase.path, nil)
+				params, ok := rp.match(splitPath(request))
+				if ok != tcase.match {
+					t.Errorf("unexpected match result for %s on %s", tcase.path, tcase.template)
+				}
+				if fmt.Sprint(params) != fmt.Sprint(tcase.params) {
+					t.Errorf("unexpected params: %v", params)
+				}
+			})
+		}
+	})
+
+	t.Run("static segments take precedence over params", func(t *testing.T) {
+		static := newRoutePath("/users/me")
+		param := newRoutePath("/users/{id}")
+		if !static.moreSpecific(param) || param.moreSpecific(static) {
+			t.Error("static route should be more specific")
+		}
+	})
+
+	t.Run("holds one route per method", func(t *testing.T) {
+		rp := newRoutePath("/items")
+		rp.add(&Route{method: "POST", endpoint: newEndpoint(func() {}, New())})
+		rp.add(&Route{method: "GET", endpoint: newEndpoint(func() {}, New())})
+		if fmt.Sprint(rp.methods()) != "[GET POST]" {
+			t.Errorf("unexpected methods: %v", rp.methods())
+		}
+	})
+
+	t.Run("rejects duplicate method on the same path", func(t *testing.T) {
+		defer assertPanics(t, "duplicate route")
+		rp := newRoutePath("/items")
+		rp.add(&Route{method: "GET", endpoint: newEndpoint(func() {}, New())})
+		rp.add(&Route{method: "GET", endpoint: newEndpoint(func() {}, New())})
+	})
+}
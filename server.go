@@ -0,0 +1,89 @@
+package gap
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long in-flight requests are given to finish when ServerOptions doesn't say otherwise
+const DefaultShutdownTimeout = 10 * time.Second
+
+// ServerOptions configures the web server started by RunWithOptions
+type ServerOptions struct {
+	Addr            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	MaxHeaderBytes  int
+	TLSCertFile     string
+	TLSKeyFile      string
+	ShutdownTimeout time.Duration
+}
+
+// Server creates an http.Server for the app, configured with the given options
+// Open WebSocket connections are closed once the server shuts down.
+func (app *App) Server(options ServerOptions) *http.Server {
+	server := &http.Server{
+		Addr:           options.Addr,
+		Handler:        app,
+		ReadTimeout:    options.ReadTimeout,
+		WriteTimeout:   options.WriteTimeout,
+		IdleTimeout:    options.IdleTimeout,
+		MaxHeaderBytes: options.MaxHeaderBytes,
+	}
+	server.RegisterOnShutdown(app.sockets.closeAll)
+	return server
+}
+
+// RunWithOptions starts a web server for the app and blocks until it receives SIGINT or SIGTERM.
+// In-flight requests are then given ShutdownTimeout to finish, before shutdown hooks are called.
+// WebSocket connections are closed with code 1001, and their endpoints given the same time to return.
+// TLS is used if both TLSCertFile and TLSKeyFile are set.
+func (app *App) RunWithOptions(options ServerOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return app.serve(ctx, app.Server(options), options)
+}
+
+// OnShutdown registers a function to be called after the server started by RunWithOptions shuts down.
+// Hooks are called in reverse order of registration, like deferred calls.
+func (app *App) OnShutdown(hook func()) {
+	app.shutdownHooks = append(app.shutdownHooks, hook)
+}
+
+func (app *App) serve(ctx context.Context, server *http.Server, options ServerOptions) error {
+	errs := make(chan error, 1)
+	go func() {
+		if options.TLSCertFile != "" && options.TLSKeyFile != "" {
+			errs <- server.ListenAndServeTLS(options.TLSCertFile, options.TLSKeyFile)
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-errs:
+		app.runShutdownHooks()
+		return err
+	case <-ctx.Done():
+	}
+	timeout := options.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	app.sockets.wait(shutdownCtx)
+	app.runShutdownHooks()
+	return err
+}
+
+func (app *App) runShutdownHooks() {
+	for i := len(app.shutdownHooks) - 1; i >= 0; i-- {
+		app.shutdownHooks[i]()
+	}
+}
@@ -0,0 +1,156 @@
+package gap
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+
+	t.Run("server is configured with options", func(t *testing.T) {
+		app := New()
+		server := app.Server(ServerOptions{
+			Addr:           ":9000",
+			ReadTimeout:    time.Second,
+			WriteTimeout:   2 * time.Second,
+			IdleTimeout:    3 * time.Second,
+			MaxHeaderBytes: 1024,
+		})
+		if server.Addr != ":9000" || server.Handler != app || server.ReadTimeout != time.Second ||
+			server.WriteTimeout != 2*time.Second || server.IdleTimeout != 3*time.Second || server.MaxHeaderBytes != 1024 {
+			t.Errorf("unexpected server configuration: %+v", server)
+		}
+	})
+
+	t.Run("shuts down gracefully when context is done", func(t *testing.T) {
+		started, release := make(chan bool), make(chan bool)
+		app := New()
+		app.Route("GET", "/slow", func() {
+			started <- true
+			<-release
+		})
+		hooks := []string{}
+		app.OnShutdown(func() { hooks = append(hooks, "first") })
+		app.OnShutdown(func() { hooks = append(hooks, "second") })
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := listener.Addr().String()
+		listener.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- app.serve(ctx, app.Server(ServerOptions{Addr: addr}), ServerOptions{}) }()
+		statuses := make(chan int)
+		go func() {
+			for {
+				response, err := http.Get("http://" + addr + "/slow")
+				if err == nil {
+					statuses <- response.StatusCode
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+		<-started
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		if len(hooks) != 0 {
+			t.Error("hooks were called before requests finished")
+		}
+		release <- true
+		if status := <-statuses; status != 200 {
+			t.Errorf("in-flight request was not drained: %d", status)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if strings.Join(hooks, ",") != "second,first" {
+			t.Errorf("unexpected hook calls: %v", hooks)
+		}
+	})
+
+	t.Run("shutdown gives up on requests after timeout", func(t *testing.T) {
+		started, release := make(chan bool), make(chan bool)
+		defer close(release)
+		app := New()
+		app.Route("GET", "/stuck", func() {
+			started <- true
+			<-release
+		})
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := listener.Addr().String()
+		listener.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		options := ServerOptions{Addr: addr, ShutdownTimeout: 50 * time.Millisecond}
+		go func() { done <- app.serve(ctx, app.Server(options), options) }()
+		go func() {
+			for {
+				if _, err := http.Get("http://" + addr + "/stuck"); err == nil {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+		<-started
+		cancel()
+		if err := <-done; err != context.DeadlineExceeded {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("listen errors are returned and hooks are called", func(t *testing.T) {
+		called := false
+		app := New()
+		app.OnShutdown(func() { called = true })
+		options := ServerOptions{Addr: "127.0.0.1:0", TLSCertFile: "missing.crt", TLSKeyFile: "missing.key"}
+		err := app.serve(context.Background(), app.Server(options), options)
+		if err == nil || !called {
+			t.Errorf("unexpected result: %v, %v", err, called)
+		}
+	})
+
+	t.Run("open websockets are closed before shutdown hooks", func(t *testing.T) {
+		connected := make(chan bool)
+		returned := false
+		app := New()
+		app.WebSocket("/ws", func(conn *Conn) {
+			connected <- true
+			var message string
+			for conn.Receive(&message) == nil {
+			}
+			returned = true
+		})
+		hookSawReturn := make(chan bool, 1)
+		app.OnShutdown(func() { hookSawReturn <- returned })
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := listener.Addr().String()
+		listener.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- app.serve(ctx, app.Server(ServerOptions{Addr: addr}), ServerOptions{}) }()
+		var conn *Conn
+		for {
+			var err error
+			if conn, err = DialWebSocket("ws://"+addr+"/ws", nil); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		defer conn.Close()
+		<-connected
+		cancel()
+		_, opcode, payload, err := conn.readFrame()
+		if err != nil || opcode != opClose || len(payload) < 2 || int(payload[0])<<8|int(payload[1]) != CloseGoingAway {
+			t.Errorf("unexpected close frame: %d %v %v", opcode, payload, err)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if !<-hookSawReturn {
+			t.Error("hooks were called before the websocket endpoint returned")
+		}
+	})
+}
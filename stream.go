@@ -0,0 +1,186 @@
+package gap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Event is a Server-Sent Event.
+// Data is sent as is if it's a string, or encoded to JSON otherwise.
+// Items of other types streamed as SSE are sent as the data of an event.
+type Event struct {
+	ID    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+var streamMimes = map[string]string{
+	"sse":     "text/event-stream",
+	"ndjson":  "application/x-ndjson",
+	"chunked": "",
+}
+
+var bytesType = reflect.TypeOf([]byte{})
+
+type streamOutput struct {
+	format string
+}
+
+// newStreamOutput accepts a channel or an iterator callback (func(yield func(T) bool)) of items.
+// Chunked streams only take strings or bytes, sent as they are.
+func newStreamOutput(rtype reflect.Type, format string) streamOutput {
+	if _, found := streamMimes[format]; !found {
+		panic(invalidOutputTag)
+	}
+	itemType, ok := streamItemType(rtype)
+	if !ok {
+		panic(unsupportedOutput("receive channel or func(yield func(T) bool)"))
+	}
+	if format == "chunked" && itemType != stringType && itemType != bytesType {
+		panic(unsupportedOutput("stream of string or []byte"))
+	}
+	return streamOutput{format}
+}
+
+func streamItemType(rtype reflect.Type) (reflect.Type, bool) {
+	if rtype.Kind() == reflect.Chan && rtype.ChanDir()&reflect.RecvDir != 0 {
+		return rtype.Elem(), true
+	}
+	if rtype.Kind() == reflect.Func && rtype.NumIn() == 1 && rtype.NumOut() == 0 {
+		yield := rtype.In(0)
+		if yield.Kind() == reflect.Func && yield.NumIn() == 1 && yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool {
+			return yield.In(0), true
+		}
+	}
+	return nil, false
+}
+
+func (output streamOutput) write(response *lazyResponse, value reflect.Value) {
+	if !value.IsNil() {
+		response.stream = &responseStream{output.format, value}
+	}
+}
+
+type responseStream struct {
+	format string
+	source reflect.Value
+}
+
+// each calls emit with every item, until the source is exhausted, done is closed or emit returns false
+func (stream *responseStream) each(done <-chan struct{}, emit func(item interface{}) bool) {
+	if stream.source.Kind() == reflect.Chan {
+		cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: stream.source}}
+		if done != nil {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+		}
+		for {
+			chosen, item, ok := reflect.Select(cases)
+			if chosen > 0 || !ok || !emit(item.Interface()) {
+				return
+			}
+		}
+	}
+	stopped := false
+	yield := reflect.MakeFunc(stream.source.Type().In(0), func(args []reflect.Value) []reflect.Value {
+		if !stopped {
+			select {
+			case <-done:
+				stopped = true
+			default:
+				stopped = !emit(args[0].Interface())
+			}
+		}
+		return []reflect.Value{reflect.ValueOf(!stopped)}
+	})
+	stream.source.Call([]reflect.Value{yield})
+}
+
+// sendStream writes each item as soon as it's available, flushing it to the client
+func (response *lazyResponse) sendStream() {
+	header := response.httpResponse.Header()
+	if mime := streamMimes[response.stream.format]; mime != "" && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", mime)
+	}
+	if response.stream.format == "sse" && header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", "no-cache")
+	}
+	response.httpResponse.WriteHeader(response.status)
+	flusher, _ := response.httpResponse.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	response.stream.each(response.done, func(item interface{}) bool {
+		if err := writeStreamItem(response.httpResponse, response.stream.format, item); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	})
+}
+
+func writeStreamItem(writer io.Writer, format string, item interface{}) error {
+	var body []byte
+	switch format {
+	case "sse":
+		event, ok := item.(Event)
+		if !ok {
+			event = Event{Data: item}
+		}
+		data, err := eventData(event.Data)
+		if err != nil {
+			return err
+		}
+		body = formatEvent(event, data)
+	case "ndjson":
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		body = append(encoded, '\n')
+	default:
+		if str, ok := item.(string); ok {
+			body = []byte(str)
+		} else {
+			body = item.([]byte)
+		}
+	}
+	_, err := writer.Write(body)
+	return err
+}
+
+func eventData(data interface{}) (string, error) {
+	switch v := data.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	encoded, err := json.Marshal(data)
+	return string(encoded), err
+}
+
+func formatEvent(event Event, data string) []byte {
+	var builder strings.Builder
+	if event.ID != "" {
+		fmt.Fprintf(&builder, "id: %s\n", event.ID)
+	}
+	if event.Event != "" {
+		fmt.Fprintf(&builder, "event: %s\n", event.Event)
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&builder, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&builder, "data: %s\n", line)
+	}
+	builder.WriteString("\n")
+	return []byte(builder.String())
+}
@@ -0,0 +1,179 @@
+package gap
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+
+	t.Run("can stream channel items as server-sent events", func(t *testing.T) {
+		type tOut struct {
+			Events <-chan interface{} `response:"stream,sse"`
+		}
+		fn := func() tOut {
+			events := make(chan interface{}, 3)
+			events <- Event{ID: "1", Event: "greeting", Data: "hello\nworld", Retry: 3 * time.Second}
+			events <- Event{Data: map[string]int{"count": 2}}
+			events <- "plain"
+			close(events)
+			return tOut{events}
+		}
+		ep := newEndpoint(fn, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/events", nil), response)
+		expected := "id: 1\nevent: greeting\nretry: 3000\ndata: hello\ndata: world\n\n" +
+			"data: {\"count\":2}\n\n" +
+			"data: plain\n\n"
+		if response.Body.String() != expected {
+			t.Errorf("unexpected body: %q", response.Body.String())
+		}
+		if response.Header().Get("Content-Type") != "text/event-stream" || response.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("unexpected headers: %v", response.Header())
+		}
+		if !response.Flushed {
+			t.Error("stream was not flushed")
+		}
+	})
+
+	t.Run("streams are not cut off by the route timeout", func(t *testing.T) {
+		type tOut struct {
+			Events <-chan interface{} `response:"stream,sse"`
+		}
+		fn := func() tOut {
+			events := make(chan interface{})
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				events <- "late"
+				close(events)
+			}()
+			return tOut{events}
+		}
+		ep := newEndpoint(fn, New())
+		ep.timeout = 10 * time.Millisecond
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/events", nil), response)
+		if response.Body.String() != "data: late\n\n" {
+			t.Errorf("unexpected body: %q", response.Body.String())
+		}
+	})
+	t.Run("can stream iterator items as ndjson", func(t *testing.T) {
+		type tItem struct {
+			ID int `json:"id"`
+		}
+		type tOut struct {
+			Items func(yield func(tItem) bool) `response:"stream,ndjson"`
+		}
+		fn := func() tOut {
+			return tOut{func(yield func(tItem) bool) {
+				for i := 1; i <= 3 && yield(tItem{i}); i++ {
+				}
+			}}
+		}
+		ep := newEndpoint(fn, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/items", nil), response)
+		if response.Body.String() != "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n" {
+			t.Errorf("unexpected body: %q", response.Body.String())
+		}
+		if response.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected content type: %s", response.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("can stream chunks with headers and status", func(t *testing.T) {
+		type tOut struct {
+			Status      int                     `response:"status"`
+			ContentType string                  `response:"header,Content-Type"`
+			Chunks      chan string             `response:"stream,chunked"`
+			Bytes       func(func([]byte) bool) `response:"stream,chunked"`
+		}
+		fn := func() tOut {
+			chunks := make(chan string, 2)
+			chunks <- "lorem "
+			chunks <- "ipsum"
+			close(chunks)
+			return tOut{Status: 201, ContentType: "text/plain", Chunks: chunks}
+		}
+		ep := newEndpoint(fn, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/chunks", nil), response)
+		if response.Code != 201 || response.Body.String() != "lorem ipsum" || response.Header().Get("Content-Type") != "text/plain" {
+			t.Errorf("unexpected response: %d %q %v", response.Code, response.Body.String(), response.Header())
+		}
+	})
+
+	t.Run("stops streaming when the client disconnects", func(t *testing.T) {
+		type tOut struct {
+			Ticks func(yield func(int) bool) `response:"stream,ndjson"`
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		sent := 0
+		fn := func() tOut {
+			return tOut{func(yield func(int) bool) {
+				for i := 0; i < 100; i++ {
+					if i == 2 {
+						cancel()
+					}
+					if !yield(i) {
+						return
+					}
+					sent++
+				}
+			}}
+		}
+		ep := newEndpoint(fn, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/ticks", nil).WithContext(ctx), response)
+		if sent != 2 || response.Body.String() != "0\n1\n" {
+			t.Errorf("unexpected stream: %d %q", sent, response.Body.String())
+		}
+	})
+
+	t.Run("stops reading channels when the client disconnects", func(t *testing.T) {
+		type tOut struct {
+			Ticks chan int `response:"stream,ndjson"`
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		fn := func() tOut {
+			ticks := make(chan int)
+			go func() {
+				ticks <- 1
+				cancel()
+			}()
+			return tOut{ticks}
+		}
+		ep := newEndpoint(fn, New())
+		response := httptest.NewRecorder()
+		ep.handle(httptest.NewRequest("GET", "/ticks", nil).WithContext(ctx), response)
+		if response.Body.String() != "1\n" {
+			t.Errorf("unexpected body: %q", response.Body.String())
+		}
+	})
+
+	t.Run("rejects unsupported stream fields", func(t *testing.T) {
+		type tSendOnly struct {
+			Items chan<- string `response:"stream,sse"`
+		}
+		type tChunks struct {
+			Items chan int `response:"stream,chunked"`
+		}
+		type tFormat struct {
+			Items chan string `response:"stream,xml"`
+		}
+		func() {
+			defer assertTagPanics(t, "unsupported type on output field")
+			newEndpoint(func() tSendOnly { return tSendOnly{} }, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "unsupported type on output field")
+			newEndpoint(func() tChunks { return tChunks{} }, New())
+		}()
+		func() {
+			defer assertTagPanics(t, "missing or invalid response tag on output field")
+			newEndpoint(func() tFormat { return tFormat{} }, New())
+		}()
+	})
+}
@@ -0,0 +1,53 @@
+package gap
+
+import (
+	"mime/multipart"
+	"net/textproto"
+	"reflect"
+)
+
+// DefaultUploadMemory is how much of a multipart body is kept in memory when the app doesn't say otherwise.
+// The remainder is stored on temporary files.
+const DefaultUploadMemory = 32 << 20
+
+var (
+	fileType      = reflect.TypeOf(File{})
+	filePtrType   = reflect.TypeOf(&File{})
+	fileSliceType = reflect.TypeOf([]File{})
+)
+
+// File is a file uploaded on a multipart form
+type File struct {
+	Filename    string
+	Size        int64
+	ContentType string
+	Header      textproto.MIMEHeader
+	header      *multipart.FileHeader
+}
+
+func newFile(header *multipart.FileHeader) File {
+	return File{
+		Filename:    header.Filename,
+		Size:        header.Size,
+		ContentType: header.Header.Get("Content-Type"),
+		Header:      header.Header,
+		header:      header,
+	}
+}
+
+// Open gives access to the file contents. The caller should close it.
+func (file File) Open() (multipart.File, error) {
+	return file.header.Open()
+}
+
+type uploadLimits struct {
+	memory int64
+	total  int64
+}
+
+// UploadLimits sets how many bytes of multipart bodies are kept in memory (the remainder goes to temporary files),
+// and how many bytes form bodies can have in total. A zero total means no limit.
+// Bodies over the total limit are answered with 413 Request Entity Too Large.
+func (app *App) UploadLimits(memory int64, total int64) {
+	app.uploadLimits = uploadLimits{memory, total}
+}
@@ -0,0 +1,162 @@
+package gap
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type fieldValidation struct {
+	index  []int
+	source string
+	name   string
+	rules  []validationRule
+}
+
+// validationRule returns a description of the violation or an empty string if value is valid
+type validationRule func(value reflect.Value) string
+
+func newFieldValidation(field reflect.StructField) (fieldValidation, bool) {
+	tag := field.Tag.Get("validate")
+	if tag == "" {
+		return fieldValidation{}, false
+	}
+	validation := fieldValidation{index: field.Index, source: inputSource(field), name: inputName(field)}
+	for _, part := range splitTag(tag) {
+		validation.rules = append(validation.rules, newValidationRule(part, field.Type))
+	}
+	return validation, true
+}
+
+// inputName is how an input field is referred to on error messages
+func inputName(field reflect.StructField) string {
+	tagParts := splitTag(field.Tag.Get("request"))
+	if len(tagParts) > 1 && tagParts[1] != "" {
+		return tagParts[1]
+	}
+	return field.Name
+}
+
+// inputSource is the kind of input a field is bound to (e.g. query, json)
+func inputSource(field reflect.StructField) string {
+	return splitTag(field.Tag.Get("request"))[0]
+}
+
+func newValidationRule(rule string, rtype reflect.Type) validationRule {
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	if rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+	switch {
+	case name == "required" && arg == "":
+		return requiredRule
+	case (name == "min" || name == "max") && isMeasurable(rtype):
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err == nil {
+			return newLimitRule(name == "min", limit)
+		}
+	case name == "oneof" && arg != "":
+		return newOneOfRule(strings.Fields(arg))
+	}
+	panic(fieldError{tag: "validate", reason: "invalid validate tag on input field"})
+}
+
+func (validation fieldValidation) validate(value reflect.Value) []InputProblem {
+	var problems []InputProblem
+	for _, rule := range validation.rules {
+		violation := rule(value)
+		if violation != "" {
+			problems = append(problems, InputProblem{validation.source, validation.name, violation})
+		}
+	}
+	return problems
+}
+
+func requiredRule(value reflect.Value) string {
+	if value.IsZero() {
+		return "is required"
+	}
+	return ""
+}
+
+func isMeasurable(rtype reflect.Type) bool {
+	switch rtype.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64,
+		reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	}
+	return false
+}
+
+func newLimitRule(isMin bool, limit float64) validationRule {
+	return func(value reflect.Value) string {
+		value, ok := derefValue(value)
+		if !ok {
+			return ""
+		}
+		var measure float64
+		unit := ""
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			measure = float64(value.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			measure = float64(value.Uint())
+		case reflect.Float32, reflect.Float64:
+			measure = value.Float()
+		case reflect.String:
+			measure = float64(utf8.RuneCountInString(value.String()))
+			unit = " characters"
+		default:
+			measure = float64(value.Len())
+			unit = " items"
+		}
+		limitStr := strconv.FormatFloat(limit, 'f', -1, 64)
+		if isMin && measure < limit {
+			if unit != "" {
+				return "must have at least " + limitStr + unit
+			}
+			return "must be at least " + limitStr
+		}
+		if !isMin && measure > limit {
+			if unit != "" {
+				return "must have at most " + limitStr + unit
+			}
+			return "must be at most " + limitStr
+		}
+		return ""
+	}
+}
+
+func newOneOfRule(options []string) validationRule {
+	return func(value reflect.Value) string {
+		value, ok := derefValue(value)
+		if !ok {
+			return ""
+		}
+		str := fmt.Sprint(value.Interface())
+		for _, option := range options {
+			if str == option {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", ")
+	}
+}
+
+// derefValue follows pointers, telling if there's a value at the end of them
+func derefValue(value reflect.Value) (reflect.Value, bool) {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return value, false
+		}
+		value = value.Elem()
+	}
+	return value, true
+}
@@ -0,0 +1,82 @@
+package gap
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+
+	t.Run("reports violations of each rule", func(t *testing.T) {
+		type tIn struct {
+			Title  string   `request:"json,title" validate:"required"`
+			Page   int      `request:"query,page" validate:"min=1,max=100"`
+			Name   string   `request:"query,name" validate:"min=2,max=3"`
+			Tags   []string `request:"json,tags" validate:"max=1"`
+			Status string   `request:"query,status" validate:"oneof=active inactive"`
+			Limit  *int     `request:"query,limit" validate:"min=1"`
+		}
+		type testCase struct {
+			field      string
+			value      interface{}
+			violations []string
+		}
+		zero, two := 0, 2
+		cases := []testCase{
+			testCase{"Title", "", []string{"json title is required"}},
+			testCase{"Title", "lorem", []string{}},
+			testCase{"Page", 0, []string{"query page must be at least 1"}},
+			testCase{"Page", 101, []string{"query page must be at most 100"}},
+			testCase{"Page", 50, []string{}},
+			testCase{"Name", "a", []string{"query name must have at least 2 characters"}},
+			testCase{"Name", "ação", []string{"query name must have at most 3 characters"}},
+			testCase{"Tags", []string{"a", "b"}, []string{"json tags must have at most 1 items"}},
+			testCase{"Status", "deleted", []string{"query status must be one of: active, inactive"}},
+			testCase{"Status", "active", []string{}},
+			testCase{"Limit", (*int)(nil), []string{}},
+			testCase{"Limit", &zero, []string{"query limit must be at least 1"}},
+			testCase{"Limit", &two, []string{}},
+		}
+		for i, tcase := range cases {
+			t.Run(fmt.Sprintf("case %d", i+1), func(t *testing.T) {
+				field, _ := reflect.TypeOf(tIn{}).FieldByName(tcase.field)
+				validation, _ := newFieldValidation(field)
+				violations := []string{}
+				for _, problem := range validation.validate(reflect.ValueOf(tcase.value)) {
+					violations = append(violations, problem.Source+" "+problem.Key+" "+problem.Reason)
+				}
+				if !reflect.DeepEqual(violations, tcase.violations) {
+					t.Errorf("unexpected violations: %v", violations)
+				}
+			})
+		}
+	})
+
+	t.Run("fields without validate tag have no validation", func(t *testing.T) {
+		field := reflect.StructField{Name: "Title", Type: reflect.TypeOf("")}
+		if _, ok := newFieldValidation(field); ok {
+			t.Error("unexpected validation")
+		}
+	})
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		tags := []reflect.StructTag{
+			`validate:"unknown"`,
+			`validate:"required=1"`,
+			`validate:"min"`,
+			`validate:"min=x"`,
+			`validate:"oneof="`,
+		}
+		for _, tag := range tags {
+			t.Run(string(tag), func(t *testing.T) {
+				defer assertPanics(t, "invalid validate tag on input field")
+				newFieldValidation(reflect.StructField{Name: "Field", Type: reflect.TypeOf(0), Tag: tag})
+			})
+		}
+		t.Run("min on bool", func(t *testing.T) {
+			defer assertPanics(t, "invalid validate tag on input field")
+			newFieldValidation(reflect.StructField{Name: "Field", Type: reflect.TypeOf(true), Tag: `validate:"min=1"`})
+		})
+	})
+}
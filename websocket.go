@@ -0,0 +1,522 @@
+package gap
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Close codes sent when closing connections, as defined by RFC 6455
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooBig        = 1009
+	CloseInternalError = 1011
+)
+
+// DefaultMaxMessageSize is the largest WebSocket message read when the app doesn't say otherwise, in bytes
+const DefaultMaxMessageSize = 16 << 20
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var connType = reflect.TypeOf((*Conn)(nil))
+
+// Conn is a WebSocket connection exchanging JSON messages.
+// Send can be called concurrently, while Receive should be called from a single goroutine.
+type Conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	client  bool
+	maxSize int64
+	mutex   sync.Mutex
+	closed  bool
+}
+
+func newSocketEndpoint(function interface{}, app *App) endpoint {
+	ep := endpoint{app: app, socket: true}
+	ep.rval = reflect.ValueOf(function)
+	ep.rtype = reflect.TypeOf(function)
+	if ep.rtype.Kind() != reflect.Func || ep.rtype.NumOut() > 1 || (ep.rtype.NumOut() == 1 && !typeIsError(ep.rtype.Out(0))) {
+		panic(errors.New("invalid websocket interface"))
+	}
+	ep.setupParams(app.providers)
+	if ep.connIndex < 0 {
+		panic(errors.New("invalid websocket interface"))
+	}
+	ep.name = runtime.FuncForPC(ep.rval.Pointer()).Name()
+	if errs := ep.setupInputFields(); len(errs) > 0 {
+		app.reportTagErrors(errs)
+	}
+	return ep
+}
+
+func (ep *endpoint) handleSocket(request *http.Request, httpResponse http.ResponseWriter) {
+	args := ep.readSocketArgs(request, httpResponse)
+	if args == nil {
+		return
+	}
+	conn := upgrade(httpResponse, request, ep.app.maxMessageSize)
+	ep.app.sockets.add(conn)
+	defer ep.app.sockets.remove(conn)
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			conn.CloseWith(CloseInternalError, "")
+			panic(ierr)
+		}
+	}()
+	args[ep.connIndex] = reflect.ValueOf(conn)
+	result := ep.rval.Call(args)
+	if len(result) > 0 && !result[0].IsNil() {
+		conn.CloseWith(CloseInternalError, result[0].Interface().(error).Error())
+		return
+	}
+	conn.Close()
+}
+
+// openSockets tracks the connections of running WebSocket endpoints. Once hijacked, connections are no longer
+// tracked by the server, so they are closed and waited for here on shutdown.
+type openSockets struct {
+	mutex   sync.Mutex
+	conns   map[*Conn]bool
+	running sync.WaitGroup
+}
+
+func (sockets *openSockets) add(conn *Conn) {
+	sockets.mutex.Lock()
+	defer sockets.mutex.Unlock()
+	if sockets.conns == nil {
+		sockets.conns = map[*Conn]bool{}
+	}
+	sockets.conns[conn] = true
+	sockets.running.Add(1)
+}
+
+func (sockets *openSockets) remove(conn *Conn) {
+	sockets.mutex.Lock()
+	defer sockets.mutex.Unlock()
+	delete(sockets.conns, conn)
+	sockets.running.Done()
+}
+
+// closeAll closes every open connection, so endpoints reading from them return
+func (sockets *openSockets) closeAll() {
+	sockets.mutex.Lock()
+	defer sockets.mutex.Unlock()
+	for conn := range sockets.conns {
+		conn.CloseWith(CloseGoingAway, "server shutting down")
+	}
+}
+
+// wait blocks until every endpoint returns, or ctx is done
+func (sockets *openSockets) wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		sockets.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// readSocketArgs binds the input before upgrading, so invalid requests are answered like on any endpoint.
+// It returns nil if the request was answered.
+func (ep *endpoint) readSocketArgs(request *http.Request, httpResponse http.ResponseWriter) (args []reflect.Value) {
+	enc, _ := negotiate(ep.app.encoders, request.Header.Get("Accept"))
+	defer ep.writeErrorOnPanic(httpResponse, enc)
+	if err := checkHandshake(request, httpResponse.Header()); err != nil {
+		ep.writeError(httpResponse, enc, reflect.ValueOf(err))
+		return nil
+	}
+	if !ep.app.allowOrigin(request) {
+		ep.writeError(httpResponse, enc, reflect.ValueOf(RequestError{Status: 403, Message: "websocket origin not allowed"}))
+		return nil
+	}
+	args, err := ep.readArgs(request)
+	if err != nil {
+		ep.writeError(httpResponse, enc, reflect.ValueOf(err))
+		return nil
+	}
+	return args
+}
+
+func checkHandshake(request *http.Request, header http.Header) error {
+	if request.Method != "GET" ||
+		!headerHasToken(request.Header, "Connection", "upgrade") ||
+		!headerHasToken(request.Header, "Upgrade", "websocket") ||
+		request.Header.Get("Sec-WebSocket-Key") == "" {
+		return RequestError{Status: 400, Message: "invalid websocket handshake"}
+	}
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		header.Set("Sec-WebSocket-Version", "13")
+		return RequestError{Status: 426, Message: "unsupported websocket version"}
+	}
+	return nil
+}
+
+// MaxMessageSize sets the largest WebSocket message read by the app, in bytes.
+// Bigger messages close the connection with code 1009.
+func (app *App) MaxMessageSize(size int64) {
+	app.maxMessageSize = size
+}
+
+// CheckOrigin sets which origins can open WebSocket connections on the app.
+// By default, only handshakes without an Origin header or from the same host are accepted,
+// so browsers can't be used to open connections carrying the cookies of the app from other sites.
+// Rejected handshakes are answered with 403 Forbidden.
+func (app *App) CheckOrigin(check func(request *http.Request) bool) {
+	app.checkOrigin = check
+}
+
+func (app *App) allowOrigin(request *http.Request) bool {
+	if app.checkOrigin != nil {
+		return app.checkOrigin(request)
+	}
+	return sameOrigin(request)
+}
+
+func sameOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, request.Host)
+}
+
+func headerHasToken(header http.Header, key string, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// upgrade takes over the connection, answering the handshake along with headers already set on the response
+func upgrade(httpResponse http.ResponseWriter, request *http.Request, maxSize int64) *Conn {
+	hijacker, ok := httpResponse.(http.Hijacker)
+	if !ok {
+		panic(errors.New("response writer does not support websocket upgrade"))
+	}
+	header := httpResponse.Header().Clone()
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", acceptKey(request.Header.Get("Sec-WebSocket-Key")))
+	netConn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		panic(err)
+	}
+	netConn.SetDeadline(time.Time{})
+	buffer.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(buffer)
+	buffer.WriteString("\r\n")
+	buffer.Flush()
+	return &Conn{netConn: netConn, reader: buffer.Reader, writer: buffer.Writer, maxSize: maxSize}
+}
+
+// DialWebSocket opens a client connection to a WebSocket endpoint (ws://, wss://, http:// or https:// urls).
+// It's mostly useful for testing endpoints, e.g. against an httptest.Server.
+// Client connections read messages up to DefaultMaxMessageSize.
+func DialWebSocket(rawURL string, header http.Header) (*Conn, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	secure := target.Scheme == "wss" || target.Scheme == "https"
+	scheme, port := "http", "80"
+	if secure {
+		scheme, port = "https", "443"
+	}
+	target.Scheme = scheme
+	if target.Port() != "" {
+		port = target.Port()
+	}
+	host := net.JoinHostPort(target.Hostname(), port)
+	var netConn net.Conn
+	if secure {
+		netConn, err = tls.Dial("tcp", host, &tls.Config{ServerName: target.Hostname()})
+	} else {
+		netConn, err = net.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request, _ := http.NewRequest("GET", target.String(), nil)
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if err := request.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(netConn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if response.StatusCode != 101 || response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %s", response.Status)
+	}
+	return &Conn{netConn: netConn, reader: reader, writer: bufio.NewWriter(netConn), client: true, maxSize: DefaultMaxMessageSize}, nil
+}
+
+// Send encodes value to JSON, sending it as a text message
+func (conn *Conn) Send(value interface{}) error {
+	message, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return conn.writeFrame(opText, message)
+}
+
+// Receive waits for the next message, decoding it from JSON into value.
+// It returns io.EOF once the connection is closed.
+func (conn *Conn) Receive(value interface{}) error {
+	message, err := conn.readMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(message, value)
+}
+
+// Close sends a normal close frame and closes the connection
+func (conn *Conn) Close() error {
+	return conn.CloseWith(CloseNormal, "")
+}
+
+// CloseWith sends a close frame with code and reason, then closes the connection.
+// Reasons are truncated to 123 bytes, the most a close frame can hold. Closing an already closed connection does nothing.
+func (conn *Conn) CloseWith(code int, reason string) error {
+	reason = truncateReason(reason)
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	if conn.closed {
+		return nil
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	conn.writeFrameLocked(opClose, payload)
+	conn.closed = true
+	return conn.netConn.Close()
+}
+
+// maxCloseReason is what's left for the reason on a close frame, after the code. Control frames take 125 bytes at most.
+const maxCloseReason = 123
+
+// truncateReason cuts reason to fit a close frame, without breaking UTF-8 sequences
+func truncateReason(reason string) string {
+	if len(reason) <= maxCloseReason {
+		return reason
+	}
+	end := maxCloseReason
+	for end > 0 && !utf8.RuneStart(reason[end]) {
+		end--
+	}
+	return reason[:end]
+}
+
+func (conn *Conn) isClosed() bool {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.closed
+}
+
+// closeError is a protocol violation by the peer, closing the connection with code
+type closeError struct {
+	code   int
+	reason string
+}
+
+func (err closeError) Error() string {
+	return "websocket: " + err.reason
+}
+
+// readMessage reads frames until a whole data message is received, answering control frames on the way
+func (conn *Conn) readMessage() ([]byte, error) {
+	message, err := conn.readFrames()
+	if cerr, ok := err.(closeError); ok {
+		conn.CloseWith(cerr.code, cerr.reason)
+	} else if err != nil && conn.isClosed() {
+		return nil, io.EOF
+	}
+	return message, err
+}
+
+func (conn *Conn) readFrames() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := conn.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opPing:
+			conn.writeFrame(opPong, payload)
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			conn.CloseWith(code, "")
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, closeError{CloseProtocolError, "unexpected data frame"}
+			}
+			started = true
+			message = payload
+		case opContinuation:
+			if !started {
+				return nil, closeError{CloseProtocolError, "unexpected continuation frame"}
+			}
+			message = append(message, payload...)
+		default:
+			return nil, closeError{CloseProtocolError, "unknown opcode"}
+		}
+		if int64(len(message)) > conn.maxSize {
+			return nil, closeError{CloseTooBig, "message too big"}
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (conn *Conn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode := header[0]&0x80 != 0, header[0]&0x0f
+	masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7f)
+	if length == 126 {
+		var extended [2]byte
+		if _, err := io.ReadFull(conn.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	} else if length == 127 {
+		var extended [8]byte
+		if _, err := io.ReadFull(conn.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if masked == conn.client {
+		return false, 0, nil, closeError{CloseProtocolError, "invalid frame masking"}
+	}
+	if opcode&0x08 != 0 && (length > 125 || !fin) {
+		return false, 0, nil, closeError{CloseProtocolError, "invalid control frame"}
+	}
+	if length > uint64(conn.maxSize) {
+		return false, 0, nil, closeError{CloseTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(conn.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends a single final frame. Frames sent by clients are masked, as required by the protocol.
+func (conn *Conn) writeFrame(opcode byte, payload []byte) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.writeFrameLocked(opcode, payload)
+}
+
+func (conn *Conn) writeFrameLocked(opcode byte, payload []byte) error {
+	if conn.closed {
+		return io.EOF
+	}
+	header := []byte{0x80 | opcode, 0}
+	length := len(payload)
+	switch {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if conn.client {
+		header[1] |= 0x80
+		var mask [4]byte
+		rand.Read(mask[:])
+		header = append(header, mask[:]...)
+		masked := make([]byte, length)
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+	conn.writer.Write(header)
+	conn.writer.Write(payload)
+	return conn.writer.Flush()
+}
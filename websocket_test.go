@@ -0,0 +1,213 @@
+package gap
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebSocket(t *testing.T) {
+
+	type tIn struct {
+		Room string `request:"param,room"`
+		Name string `request:"query,name" validate:"required"`
+	}
+	type tMessage struct {
+		From string `json:"from"`
+		Text string `json:"text"`
+	}
+	app := New()
+	app.WebSocket("/rooms/{room}", func(input tIn, conn *Conn) error {
+		for {
+			var message tMessage
+			if err := conn.Receive(&message); err != nil {
+				return nil
+			}
+			if message.Text == "fail" {
+				return errors.New("failed")
+			}
+			if message.Text == "fail long" {
+				return errors.New(strings.Repeat("é", 100))
+			}
+			conn.Send(tMessage{input.Name + "@" + input.Room, strings.ToUpper(message.Text)})
+		}
+	})
+	server := httptest.NewServer(app)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	t.Run("exchanges json messages with bound input", func(t *testing.T) {
+		conn, err := DialWebSocket(url+"/rooms/lobby?name=ana", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		for _, text := range []string{"hello", strings.Repeat("a", 200), strings.Repeat("b", 70000)} {
+			conn.Send(tMessage{"client", text})
+			var reply tMessage
+			if err := conn.Receive(&reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply.From != "ana@lobby" || reply.Text != strings.ToUpper(text) {
+				t.Errorf("unexpected reply: %s %d", reply.From, len(reply.Text))
+			}
+		}
+	})
+
+	t.Run("answers pings", func(t *testing.T) {
+		conn, err := DialWebSocket(url+"/rooms/lobby?name=ana", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.writeFrame(opPing, []byte("ping"))
+		fin, opcode, payload, err := conn.readFrame()
+		if err != nil || !fin || opcode != opPong || string(payload) != "ping" {
+			t.Errorf("unexpected frame: %v %d %s %v", fin, opcode, payload, err)
+		}
+	})
+
+	t.Run("returned errors close the connection", func(t *testing.T) {
+		conn, err := DialWebSocket(url+"/rooms/lobby?name=ana", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Send(tMessage{"client", "fail"})
+		var reply tMessage
+		if err := conn.Receive(&reply); err != io.EOF {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("long error reasons are truncated to fit the close frame", func(t *testing.T) {
+		conn, err := DialWebSocket(url+"/rooms/lobby?name=ana", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Send(tMessage{"client", "fail long"})
+		_, opcode, payload, err := conn.readFrame()
+		if err != nil || opcode != opClose || len(payload) != 124 || string(payload[2:]) != strings.Repeat("é", 61) {
+			t.Errorf("unexpected close frame: %d %d %v", opcode, len(payload), err)
+		}
+	})
+
+	t.Run("invalid control frames close the connection with protocol error", func(t *testing.T) {
+		for _, frame := range [][]byte{
+			append([]byte{0x80 | opPing, 0x80 | 126, 0, 126, 0, 0, 0, 0}, make([]byte, 126)...),
+			{opPing, 0x80, 0, 0, 0, 0},
+		} {
+			conn, err := DialWebSocket(url+"/rooms/lobby?name=ana", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.netConn.Write(frame)
+			_, opcode, payload, err := conn.readFrame()
+			if err != nil || opcode != opClose || len(payload) < 2 || int(payload[0])<<8|int(payload[1]) != CloseProtocolError {
+				t.Errorf("unexpected close frame: %d %v %v", opcode, payload, err)
+			}
+			conn.Close()
+		}
+	})
+
+	t.Run("invalid input is answered before upgrading", func(t *testing.T) {
+		request, _ := http.NewRequest("GET", server.URL+"/rooms/lobby", nil)
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Upgrade", "websocket")
+		request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		request.Header.Set("Sec-WebSocket-Version", "13")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != 400 || !strings.HasPrefix(string(body), `{"error":"name is required"`) {
+			t.Errorf("unexpected response: %d %s", response.StatusCode, body)
+		}
+		if _, err := DialWebSocket(url+"/rooms/lobby", nil); err == nil || err.Error() != "websocket handshake failed: 400 Bad Request" {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("cross origin handshakes are forbidden by default", func(t *testing.T) {
+		_, err := DialWebSocket(url+"/rooms/lobby?name=ana", http.Header{"Origin": {"http://evil.example"}})
+		if err == nil || err.Error() != "websocket handshake failed: 403 Forbidden" {
+			t.Errorf("unexpected error: %v", err)
+		}
+		conn, err := DialWebSocket(url+"/rooms/lobby?name=ana", http.Header{"Origin": {server.URL}})
+		if err != nil {
+			t.Fatalf("same origin handshake failed: %v", err)
+		}
+		conn.Close()
+	})
+
+	t.Run("apps can allow other origins", func(t *testing.T) {
+		app := New()
+		app.CheckOrigin(func(request *http.Request) bool {
+			return request.Header.Get("Origin") == "http://trusted.example"
+		})
+		app.WebSocket("/ws", func(conn *Conn) {})
+		server := httptest.NewServer(app)
+		defer server.Close()
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+		conn, err := DialWebSocket(url, http.Header{"Origin": {"http://trusted.example"}})
+		if err != nil {
+			t.Fatalf("allowed origin failed: %v", err)
+		}
+		conn.Close()
+		if _, err := DialWebSocket(url, http.Header{"Origin": {server.URL}}); err == nil {
+			t.Error("origin should have been rejected")
+		}
+	})
+
+	t.Run("messages over the app size limit close the connection", func(t *testing.T) {
+		app := New()
+		app.MaxMessageSize(16)
+		app.WebSocket("/ws", func(conn *Conn) {
+			var message tMessage
+			conn.Receive(&message)
+		})
+		server := httptest.NewServer(app)
+		defer server.Close()
+		conn, err := DialWebSocket("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Send(tMessage{"client", strings.Repeat("x", 32)})
+		_, opcode, payload, err := conn.readFrame()
+		if err != nil || opcode != opClose || len(payload) < 2 || int(payload[0])<<8|int(payload[1]) != CloseTooBig {
+			t.Errorf("unexpected close frame: %d %v %v", opcode, payload, err)
+		}
+	})
+
+	t.Run("plain requests are answered with bad request", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/rooms/lobby?name=ana", nil))
+		if response.Code != 400 || response.Body.String() != `{"error":"invalid websocket handshake"}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("answers handshake with accept key", func(t *testing.T) {
+		if acceptKey("dGhlIHNhbXBsZSBub25jZQ==") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Error("unexpected accept key")
+		}
+	})
+
+	t.Run("websocket endpoints must take a connection", func(t *testing.T) {
+		defer assertPanics(t, "invalid websocket interface")
+		New().WebSocket("/ws", func(input tIn) {})
+	})
+
+	t.Run("websocket routes are left out of the openapi document", func(t *testing.T) {
+		if len(app.OpenAPI()["paths"].(map[string]interface{})) != 0 {
+			t.Error("unexpected websocket route on document")
+		}
+	})
+}
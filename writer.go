@@ -0,0 +1,37 @@
+package gap
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// OutputWriter writes output fields tagged with a custom kind, registered with App.RegisterOutput.
+// Write gets the response, the key given on the tag (e.g. next for response:"link,next") and the field value.
+// It runs before the status and body are written, so it's meant to set headers (or trailers, with http.TrailerPrefix).
+// Returned errors are handled as panics.
+type OutputWriter interface {
+	Write(response http.ResponseWriter, key string, value interface{}) error
+}
+
+// OutputWriterFunc adapts a function to the OutputWriter interface
+type OutputWriterFunc func(response http.ResponseWriter, key string, value interface{}) error
+
+// Write calls fn(response, key, value)
+func (fn OutputWriterFunc) Write(response http.ResponseWriter, key string, value interface{}) error {
+	return fn(response, key, value)
+}
+
+var builtinOutputs = map[string]bool{
+	"header": true, "field": true, "json": true, "status": true, "body": true, "stream": true, "cookie": true,
+}
+
+type customOutput struct {
+	key    string
+	writer OutputWriter
+}
+
+func (output customOutput) write(response *lazyResponse, value reflect.Value) {
+	if err := output.writer.Write(response.httpResponse, output.key, value.Interface()); err != nil {
+		panic(err)
+	}
+}
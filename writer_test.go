@@ -0,0 +1,111 @@
+package gap
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+type tLinkError struct {
+	Status int    `response:"status"`
+	Help   string `response:"link,help"`
+}
+
+func (err tLinkError) Error() string {
+	return "not found"
+}
+
+func TestOutputWriter(t *testing.T) {
+
+	app := New()
+	app.RegisterOutput("link", OutputWriterFunc(func(response http.ResponseWriter, key string, value interface{}) error {
+		if url, _ := value.(string); url != "" {
+			response.Header().Add("Link", fmt.Sprintf(`<%s>; rel="%s"`, url, key))
+		}
+		return nil
+	}))
+	app.RegisterOutput("trailer", OutputWriterFunc(func(response http.ResponseWriter, key string, value interface{}) error {
+		response.Header().Set(http.TrailerPrefix+key, fmt.Sprint(value))
+		return nil
+	}))
+	app.RegisterOutput("fail", OutputWriterFunc(func(response http.ResponseWriter, key string, value interface{}) error {
+		return errors.New("failed to write")
+	}))
+	type tOut struct {
+		Next  string `response:"link,next"`
+		Prev  string `response:"link,prev"`
+		Count int    `response:"trailer,X-Count"`
+		Items []int  `response:"field,items"`
+	}
+	app.Route("GET", "/", func() tOut {
+		return tOut{Next: "/?page=2", Count: 2, Items: []int{1, 2}}
+	})
+	app.Route("GET", "/error", func() error {
+		return tLinkError{404, "/docs"}
+	})
+	app.Route("GET", "/fail", func() struct {
+		Value string `response:"fail"`
+	} {
+		return struct {
+			Value string `response:"fail"`
+		}{}
+	})
+
+	t.Run("writes custom kinds along with built-in ones", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		if response.Code != 200 || response.Body.String() != `{"items":[1,2]}` {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+		if links := response.Header().Values("Link"); len(links) != 1 || links[0] != `</?page=2>; rel="next"` {
+			t.Errorf("unexpected links: %v", links)
+		}
+		if trailer := response.Result().Trailer.Get("X-Count"); trailer != "2" {
+			t.Errorf("unexpected trailer: %s", trailer)
+		}
+	})
+
+	t.Run("writes custom kinds on error structs", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/error", nil))
+		if response.Code != 404 || response.Header().Get("Link") != `</docs>; rel="help"` {
+			t.Errorf("unexpected response: %d %v", response.Code, response.Header())
+		}
+	})
+
+	t.Run("writer errors are handled as panics", func(t *testing.T) {
+		defer log.SetOutput(os.Stderr)
+		log.SetOutput(ioutil.Discard)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/fail", nil))
+		if response.Code != 500 {
+			t.Errorf("unexpected response: %d %s", response.Code, response.Body.String())
+		}
+	})
+
+	t.Run("built-in kinds can't be replaced", func(t *testing.T) {
+		defer assertPanics(t, "reserved output kind")
+		New().RegisterOutput("cookie", OutputWriterFunc(nil))
+	})
+
+	t.Run("kinds can't be registered twice", func(t *testing.T) {
+		defer assertPanics(t, "duplicate output writer")
+		app.RegisterOutput("link", OutputWriterFunc(nil))
+	})
+
+	t.Run("unregistered kinds are invalid", func(t *testing.T) {
+		defer assertTagPanics(t, "missing or invalid response tag on output field")
+		New().Route("GET", "/", func() struct {
+			Next string `response:"link,next"`
+		} {
+			return struct {
+				Next string `response:"link,next"`
+			}{}
+		})
+	})
+}